@@ -22,6 +22,17 @@ data "ansiblevault_path_pattern" "env" {
   key = "API_KEY"
 }
 
+data "ansiblevault_glob" "multi" {
+  pattern        = "group_vars/tag_multi/*.yml"
+  key            = "DB_PASSWORD"
+  merge_strategy = "last"
+}
+
+data "ansiblevault_role_var" "role" {
+  role = "app"
+  key  = "DB_PASSWORD"
+}
+
 data "ansiblevault_string" "key_string" {
   encrypted = <<EOF
 $ANSIBLE_VAULT;1.1;AES256
@@ -46,6 +57,14 @@ output "env" {
   value = data.ansiblevault_path_pattern.env.value
 }
 
+output "multi" {
+  value = data.ansiblevault_glob.multi.value
+}
+
+output "role" {
+  value = data.ansiblevault_role_var.role.value
+}
+
 output "key_string" {
   value = data.ansiblevault_string.key_string.value
 }
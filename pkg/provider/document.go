@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// withDocument adds argument selecting a document of multi-document vault files to given data source schema
+func withDocument(resourceSchema map[string]*schema.Schema) map[string]*schema.Schema {
+	resourceSchema["document"] = &schema.Schema{
+		Type:         schema.TypeInt,
+		Description:  "Index of the document read in multi-document yaml vault files, from zero, other formats only support 0",
+		Optional:     true,
+		Default:      0,
+		ValidateFunc: validation.IntAtLeast(0),
+	}
+
+	return resourceSchema
+}
+
+// inDocument returns vault app reading document selected by data
+func inDocument(data *schema.ResourceData, m interface{}) vault.App {
+	return m.(*vault.App).InDocument(data.Get("document").(int))
+}
@@ -0,0 +1,26 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+)
+
+// vaultError adds a hint on how to fix given vault error
+func vaultError(err error) error {
+	var fileNotFound *vault.FileNotFoundError
+
+	switch {
+	case errors.Is(err, vault.ErrWrongPassword):
+		return fmt.Errorf("%w, check vault_pass or vault_path of the provider", err)
+	case errors.Is(err, vault.ErrNotVault):
+		return fmt.Errorf("%w, content must start with `$ANSIBLE_VAULT` header", err)
+	case errors.Is(err, vault.ErrLocked):
+		return fmt.Errorf("%w, retry later or increase lock_timeout of the provider", err)
+	case errors.As(err, &fileNotFound):
+		return fmt.Errorf("%w, path is relative to root_folder of the provider", err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,24 @@
+package provider
+
+import (
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// withFormat adds argument selecting payload format of vault files to given data source schema
+func withFormat(resourceSchema map[string]*schema.Schema) map[string]*schema.Schema {
+	resourceSchema["format"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Description:  "Format of decrypted payload: 'yaml', 'json', 'dotenv', 'ini' or 'raw', detected from file extension if empty",
+		Optional:     true,
+		ValidateFunc: validation.StringInSlice(vault.Formats, false),
+	}
+
+	return resourceSchema
+}
+
+// inFormat returns vault app reading document and format selected by data
+func inFormat(data *schema.ResourceData, m interface{}) vault.App {
+	return inDocument(data, m).InFormat(data.Get("format").(string))
+}
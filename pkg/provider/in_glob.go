@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func inGlobResource() *schema.Resource {
+	return &schema.Resource{
+		Read: inGlobRead,
+		Schema: withFormat(withDocument(map[string]*schema.Schema{
+			"pattern": {
+				Type:        schema.TypeString,
+				Description: "Glob pattern or directory of vault files (example: 'group_vars/prod/*.yml')",
+				Required:    true,
+			},
+			"key": {
+				Type:        schema.TypeString,
+				Description: "Vault key searched",
+				Required:    true,
+			},
+			"merge_strategy": {
+				Type:         schema.TypeString,
+				Description:  "Behavior when key is defined in several files: 'error', 'first' or 'last'",
+				Optional:     true,
+				Default:      vault.MergeError,
+				ValidateFunc: validation.StringInSlice(vault.MergeStrategies, false),
+			},
+			"value": {
+				Computed:    true,
+				Description: "Vault value found",
+				Type:        schema.TypeString,
+			},
+			"file": {
+				Computed:    true,
+				Description: "Vault file where value was found, relative to root folder",
+				Type:        schema.TypeString,
+			},
+		})),
+	}
+}
+
+func inGlobRead(data *schema.ResourceData, m interface{}) error {
+	pattern := data.Get("pattern").(string)
+	key := data.Get("key").(string)
+	mergeStrategy := data.Get("merge_strategy").(string)
+
+	data.SetId(time.Now().UTC().String())
+
+	value, file, err := inFormat(data, m).InGlob(pattern, key, mergeStrategy)
+	if err != nil {
+		data.SetId("")
+
+		return vaultError(err)
+	}
+
+	if err := data.Set("value", value); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	if err := data.Set("file", file); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	return nil
+}
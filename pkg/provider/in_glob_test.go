@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+)
+
+func TestInGlobRead(t *testing.T) {
+	var cases = []struct {
+		intention     string
+		pattern       string
+		key           string
+		mergeStrategy string
+		want          string
+		wantErr       error
+	}{
+		{
+			"simple",
+			"group_vars/tag_multi/*.yml",
+			"API_KEY",
+			vault.MergeError,
+			"MULTI_API_KEY",
+			nil,
+		},
+		{
+			"merged key",
+			"group_vars/tag_multi",
+			"DB_PASSWORD",
+			vault.MergeLast,
+			"DB_DB_PASSWORD",
+			nil,
+		},
+		{
+			"not found key",
+			"group_vars/tag_multi/*.yml",
+			"SECRET_KEY",
+			vault.MergeError,
+			"",
+			errors.New("key `SECRET_KEY` not found in group_vars/tag_multi/*.yml"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			data := inGlobResource().Data(nil)
+
+			if err := data.Set("pattern", testCase.pattern); err != nil {
+				t.Errorf("unable to set pattern: %#v", err)
+				return
+			}
+
+			if err := data.Set("key", testCase.key); err != nil {
+				t.Errorf("unable to set key: %#v", err)
+				return
+			}
+
+			if err := data.Set("merge_strategy", testCase.mergeStrategy); err != nil {
+				t.Errorf("unable to set merge_strategy: %#v", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			err = inGlobRead(data, vaultApp)
+			result := data.Get("value").(string)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InGlobRead() = (`%s`, %#v), want (`%s`, %#v)", result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
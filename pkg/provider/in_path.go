@@ -1,7 +1,7 @@
 package provider
 
 import (
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
@@ -11,11 +11,19 @@ import (
 func inPathResource() *schema.Resource {
 	return &schema.Resource{
 		Read: inPathRead,
-		Schema: map[string]*schema.Schema{
+		Schema: withFormat(withDocument(withMissingKey(map[string]*schema.Schema{
 			"path": {
-				Type:        schema.TypeString,
-				Description: "Ansible environment searched",
-				Required:    true,
+				Type:         schema.TypeString,
+				Description:  "Ansible environment searched",
+				Optional:     true,
+				ExactlyOneOf: []string{"path", "paths"},
+			},
+			"paths": {
+				Type:        schema.TypeList,
+				Description: "Vault files searched in order, first one defining key is used",
+				Optional:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
 			},
 			"key": {
 				Type:        schema.TypeString,
@@ -27,7 +35,17 @@ func inPathResource() *schema.Resource {
 				Description: "Vault value found",
 				Type:        schema.TypeString,
 			},
-		},
+			"source": {
+				Computed:    true,
+				Description: "Vault file where value was found",
+				Type:        schema.TypeString,
+			},
+			"commit": {
+				Computed:    true,
+				Description: "Commit SHA vault files were read at, if read from git",
+				Type:        schema.TypeString,
+			},
+		}))),
 	}
 }
 
@@ -35,17 +53,41 @@ func inPathRead(data *schema.ResourceData, m interface{}) error {
 	path := data.Get("path").(string)
 	key := data.Get("key").(string)
 
+	var paths []string
+	for _, item := range data.Get("paths").([]interface{}) {
+		paths = append(paths, item.(string))
+	}
+
 	data.SetId(time.Now().UTC().String())
 
-	value, err := m.(*vault.App).InPath(path, key)
-	if err != nil {
+	if err := data.Set("commit", m.(*vault.App).Commit()); err != nil {
 		data.SetId("")
+		return err
+	}
 
-		if err == vault.ErrKeyNotFound {
-			return fmt.Errorf("%s not found in %s vault", key, path)
+	var value, source string
+	var err error
+
+	if len(paths) != 0 {
+		value, source, err = inFormat(data, m).InPaths(paths, key)
+	} else {
+		source = path
+		value, err = inFormat(data, m).InPath(path, key)
+	}
+
+	if errors.Is(err, vault.ErrKeyNotFound) && isMissingAllowed(data) {
+		if err := setMissingKey(data); err != nil {
+			data.SetId("")
+			return err
 		}
 
-		return err
+		return nil
+	}
+
+	if err != nil {
+		data.SetId("")
+
+		return vaultError(err)
 	}
 
 	if err := data.Set("value", value); err != nil {
@@ -53,5 +95,15 @@ func inPathRead(data *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
+	if err := data.Set("source", source); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	if err := data.Set("found", true); err != nil {
+		data.SetId("")
+		return err
+	}
+
 	return nil
 }
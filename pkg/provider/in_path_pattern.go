@@ -1,7 +1,7 @@
 package provider
 
 import (
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
@@ -11,11 +11,25 @@ import (
 func inPathPatternResource() *schema.Resource {
 	return &schema.Resource{
 		Read: inPathPatternRead,
-		Schema: map[string]*schema.Schema{
+		Schema: withFormat(withDocument(withMissingKey(map[string]*schema.Schema{
+			"pattern": {
+				Type:        schema.TypeString,
+				Description: "Name of the provider path pattern",
+				Optional:    true,
+				Default:     vault.DefaultPathPattern,
+			},
 			"path_params": {
-				Type:        schema.TypeMap,
-				Description: "Parameters for path pattern",
-				Required:    true,
+				Type:         schema.TypeMap,
+				Description:  "Parameters for path pattern",
+				Optional:     true,
+				ExactlyOneOf: []string{"path_params", "path_params_list"},
+			},
+			"path_params_list": {
+				Type:        schema.TypeList,
+				Description: "Parameters for path pattern tried in order, first vault file defining key is used",
+				Optional:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeMap},
 			},
 			"key": {
 				Type:        schema.TypeString,
@@ -27,25 +41,64 @@ func inPathPatternResource() *schema.Resource {
 				Description: "Vault value found",
 				Type:        schema.TypeString,
 			},
-		},
+			"source": {
+				Computed:    true,
+				Description: "Vault file where value was found",
+				Type:        schema.TypeString,
+			},
+			"commit": {
+				Computed:    true,
+				Description: "Commit SHA vault files were read at, if read from git",
+				Type:        schema.TypeString,
+			},
+		}))),
 	}
 }
 
 func inPathPatternRead(data *schema.ResourceData, m interface{}) error {
-	pathParams := data.Get("path_params").(map[string]interface{})
+	pattern := data.Get("pattern").(string)
 	key := data.Get("key").(string)
 
+	var pathParamsList []map[string]interface{}
+	for _, item := range data.Get("path_params_list").([]interface{}) {
+		pathParams, _ := item.(map[string]interface{})
+		pathParamsList = append(pathParamsList, pathParams)
+	}
+
 	data.SetId(time.Now().UTC().String())
 
-	value, err := m.(*vault.App).InPathPattern(pathParams, key)
-	if err != nil {
+	if err := data.Set("commit", m.(*vault.App).Commit()); err != nil {
 		data.SetId("")
+		return err
+	}
+
+	var value, source string
+	var err error
+
+	if len(pathParamsList) != 0 {
+		value, source, err = inFormat(data, m).InPathPatterns(pattern, pathParamsList, key)
+	} else {
+		pathParams := data.Get("path_params").(map[string]interface{})
 
-		if err == vault.ErrKeyNotFound {
-			return fmt.Errorf("not found in %s vault", key)
+		source, err = m.(*vault.App).RenderPathPattern(pattern, pathParams)
+		if err == nil {
+			value, err = inFormat(data, m).InPathPattern(pattern, pathParams, key)
 		}
+	}
 
-		return err
+	if errors.Is(err, vault.ErrKeyNotFound) && isMissingAllowed(data) {
+		if err := setMissingKey(data); err != nil {
+			data.SetId("")
+			return err
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		data.SetId("")
+
+		return vaultError(err)
 	}
 
 	if err := data.Set("value", value); err != nil {
@@ -53,5 +106,15 @@ func inPathPatternRead(data *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
+	if err := data.Set("source", source); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	if err := data.Set("found", true); err != nil {
+		data.SetId("")
+		return err
+	}
+
 	return nil
 }
@@ -1,42 +1,63 @@
 package provider
 
 import (
-	"errors"
 	"fmt"
 	"path"
 	"testing"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
 func TestInEnvRead(t *testing.T) {
 	var cases = []struct {
-		intention  string
-		pathParams map[string]interface{}
-		key        string
-		want       string
-		wantErr    error
+		intention      string
+		pathParams     map[string]interface{}
+		pathParamsList []interface{}
+		key            string
+		want           string
+		wantSource     string
+		wantErr        error
 	}{
 		{
 			"simple",
 			map[string]interface{}{"env": "prod"},
+			nil,
 			"API_KEY",
 			"PROD_KEEP_IT_SECRET",
+			"/group_vars/tag_prod/vault.yml",
 			nil,
 		},
 		{
 			"not found key",
 			map[string]interface{}{"env": "prod"},
+			nil,
 			"SECRET_KEY",
 			"",
-			errors.New("not found in SECRET_KEY vault"),
+			"",
+			fmt.Errorf("key `SECRET_KEY` not found in %s", path.Join(ansibleFolder, "group_vars/tag_prod/vault.yml")),
 		},
 		{
 			"not found env",
 			map[string]interface{}{"env": "dev"},
+			nil,
 			"SECRET_KEY",
 			"",
-			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "group_vars/tag_dev/vault.yml")),
+			"",
+			fmt.Errorf("open %s: no such file or directory, path is relative to root_folder of the provider", path.Join(ansibleFolder, "group_vars/tag_dev/vault.yml")),
+		},
+		{
+			"fallback path params",
+			nil,
+			[]interface{}{
+				map[string]interface{}{"env": "dev"},
+				map[string]interface{}{"env": "prod"},
+			},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			"/group_vars/tag_prod/vault.yml",
+			nil,
 		},
 	}
 
@@ -49,12 +70,17 @@ func TestInEnvRead(t *testing.T) {
 				return
 			}
 
+			if err := data.Set("path_params_list", testCase.pathParamsList); err != nil {
+				t.Errorf("unable to set path_params_list: %#v", err)
+				return
+			}
+
 			if err := data.Set("key", testCase.key); err != nil {
 				t.Errorf("unable to set key: %#v", err)
 				return
 			}
 
-			vaultApp, err := vault.New("secret", ansibleFolder, "/group_vars/tag_{{.env}}/vault.yml")
+			vaultApp, err := vault.New("secret", ansibleFolder, map[string]string{vault.DefaultPathPattern: "/group_vars/tag_{{.env}}/vault.yml"})
 			if err != nil {
 				t.Errorf("unable to create vault app: %#v", err)
 				return
@@ -62,6 +88,7 @@ func TestInEnvRead(t *testing.T) {
 
 			err = inPathPatternRead(data, vaultApp)
 			result := data.Get("value").(string)
+			source := data.Get("source").(string)
 
 			failed := false
 
@@ -71,7 +98,7 @@ func TestInEnvRead(t *testing.T) {
 				failed = true
 			} else if err != nil && err.Error() != testCase.wantErr.Error() {
 				failed = true
-			} else if result != testCase.want {
+			} else if result != testCase.want || source != testCase.wantSource {
 				failed = true
 			}
 
@@ -81,3 +108,103 @@ func TestInEnvRead(t *testing.T) {
 		})
 	}
 }
+
+func TestInPathPatternMissing(t *testing.T) {
+	var cases = []struct {
+		intention    string
+		defaultValue cty.Value
+		allowMissing bool
+		want         string
+		wantFound    bool
+		wantErr      error
+	}{
+		{
+			"not allowed",
+			cty.NullVal(cty.String),
+			false,
+			"",
+			false,
+			fmt.Errorf("key `SECRET_KEY` not found in %s", path.Join(ansibleFolder, "group_vars/tag_prod/vault.yml")),
+		},
+		{
+			"allow missing",
+			cty.NullVal(cty.String),
+			true,
+			"",
+			false,
+			nil,
+		},
+		{
+			"default value",
+			cty.StringVal("fallback"),
+			false,
+			"fallback",
+			false,
+			nil,
+		},
+		{
+			"empty default value",
+			cty.StringVal(""),
+			false,
+			"",
+			false,
+			nil,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			data := inPathPatternResource().Data(&terraform.InstanceState{
+				RawConfig: cty.ObjectVal(map[string]cty.Value{"default": testCase.defaultValue}),
+			})
+
+			if err := data.Set("path_params", map[string]interface{}{"env": "prod"}); err != nil {
+				t.Errorf("unable to set path_params: %#v", err)
+				return
+			}
+
+			if err := data.Set("key", "SECRET_KEY"); err != nil {
+				t.Errorf("unable to set key: %#v", err)
+				return
+			}
+
+			if !testCase.defaultValue.IsNull() {
+				if err := data.Set("default", testCase.defaultValue.AsString()); err != nil {
+					t.Errorf("unable to set default: %#v", err)
+					return
+				}
+			}
+
+			if err := data.Set("allow_missing", testCase.allowMissing); err != nil {
+				t.Errorf("unable to set allow_missing: %#v", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, map[string]string{vault.DefaultPathPattern: "/group_vars/tag_{{.env}}/vault.yml"})
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			err = inPathPatternRead(data, vaultApp)
+			result := data.Get("value").(string)
+			found := data.Get("found").(bool)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want || found != testCase.wantFound {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("inPathPatternRead() = (`%s`, %t, %#v), want (`%s`, %t, %#v)", result, found, err, testCase.want, testCase.wantFound, testCase.wantErr)
+			}
+		})
+	}
+}
@@ -11,32 +11,103 @@ import (
 
 func TestInPathRead(t *testing.T) {
 	var cases = []struct {
-		intention string
-		path      string
-		key       string
-		want      string
-		wantErr   error
+		intention    string
+		path         string
+		paths        []string
+		key          string
+		document     int
+		defaultValue string
+		want         string
+		wantSource   string
+		wantErr      error
 	}{
 		{
 			"simple",
 			"InPathRead.yml",
+			nil,
 			"API_KEY",
+			0,
+			"",
 			"PROD_KEEP_IT_SECRET",
+			"InPathRead.yml",
 			nil,
 		},
 		{
 			"not found key",
 			"InPathRead.yml",
+			nil,
 			"SECRET_KEY",
+			0,
 			"",
-			errors.New("SECRET_KEY not found in InPathRead.yml vault"),
+			"",
+			"",
+			fmt.Errorf("key `SECRET_KEY` not found in %s", path.Join(ansibleFolder, "InPathRead.yml")),
 		},
 		{
 			"not found path",
 			"InPathReadNotFound.yml",
+			nil,
 			"SECRET_KEY",
+			0,
 			"",
-			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "InPathReadNotFound.yml")),
+			"",
+			"",
+			fmt.Errorf("open %s: no such file or directory, path is relative to root_folder of the provider", path.Join(ansibleFolder, "InPathReadNotFound.yml")),
+		},
+		{
+			"fallback paths",
+			"",
+			[]string{"InPathReadNotFound.yml", "simple_vault_test.yaml", "InPathRead.yml"},
+			"API_KEY",
+			0,
+			"",
+			"NOT_IN_CLEAR_TEXT",
+			"simple_vault_test.yaml",
+			nil,
+		},
+		{
+			"not found in paths",
+			"",
+			[]string{"InPathReadNotFound.yml", "InPathRead.yml"},
+			"SECRET_KEY",
+			0,
+			"",
+			"",
+			"",
+			errors.New("key `SECRET_KEY` not found in InPathReadNotFound.yml, InPathRead.yml"),
+		},
+		{
+			"document",
+			"multi_document.yml",
+			nil,
+			"API_KEY",
+			1,
+			"",
+			"SECOND_DOCUMENT",
+			"multi_document.yml",
+			nil,
+		},
+		{
+			"json format",
+			"service_account.json",
+			nil,
+			"client_email",
+			0,
+			"",
+			"terraform@example.iam.gserviceaccount.com",
+			"service_account.json",
+			nil,
+		},
+		{
+			"default value",
+			"InPathRead.yml",
+			nil,
+			"SECRET_KEY",
+			0,
+			"fallback",
+			"fallback",
+			"",
+			nil,
 		},
 	}
 
@@ -49,12 +120,27 @@ func TestInPathRead(t *testing.T) {
 				return
 			}
 
+			if err := data.Set("default", testCase.defaultValue); err != nil {
+				t.Errorf("unable to set default: %#v", err)
+				return
+			}
+
+			if err := data.Set("paths", testCase.paths); err != nil {
+				t.Errorf("unable to set paths: %#v", err)
+				return
+			}
+
 			if err := data.Set("key", testCase.key); err != nil {
 				t.Errorf("unable to set key: %#v", err)
 				return
 			}
 
-			vaultApp, err := vault.New("secret", ansibleFolder, "")
+			if err := data.Set("document", testCase.document); err != nil {
+				t.Errorf("unable to set document: %#v", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
 			if err != nil {
 				t.Errorf("unable to create vault app: %#v", err)
 				return
@@ -62,6 +148,7 @@ func TestInPathRead(t *testing.T) {
 
 			err = inPathRead(data, vaultApp)
 			result := data.Get("value").(string)
+			source := data.Get("source").(string)
 
 			failed := false
 
@@ -71,12 +158,12 @@ func TestInPathRead(t *testing.T) {
 				failed = true
 			} else if err != nil && err.Error() != testCase.wantErr.Error() {
 				failed = true
-			} else if result != testCase.want {
+			} else if result != testCase.want || source != testCase.wantSource {
 				failed = true
 			}
 
 			if failed {
-				t.Errorf("InPathRead() = (`%s`, %#v), want (`%s`, %#v)", result, err, testCase.want, testCase.wantErr)
+				t.Errorf("InPathRead() = (`%s`, `%s`, %#v), want (`%s`, `%s`, %#v)", result, source, err, testCase.want, testCase.wantSource, testCase.wantErr)
 			}
 		})
 	}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func inRoleResource() *schema.Resource {
+	return &schema.Resource{
+		Read: inRoleRead,
+		Schema: withDocument(withMissingKey(map[string]*schema.Schema{
+			"role": {
+				Type:        schema.TypeString,
+				Description: "Role name, or fully qualified collection name (example: 'namespace.collection.role')",
+				Required:    true,
+			},
+			"key": {
+				Type:        schema.TypeString,
+				Description: "Vault key searched",
+				Required:    true,
+			},
+			"value": {
+				Computed:    true,
+				Description: "Vault value found",
+				Type:        schema.TypeString,
+			},
+			"source": {
+				Computed:    true,
+				Description: "Role variables file where value was found, relative to root_folder when inside of it",
+				Type:        schema.TypeString,
+			},
+			"commit": {
+				Computed:    true,
+				Description: "Commit SHA vault files were read at, if read from git",
+				Type:        schema.TypeString,
+			},
+		})),
+	}
+}
+
+func inRoleRead(data *schema.ResourceData, m interface{}) error {
+	role := data.Get("role").(string)
+	key := data.Get("key").(string)
+
+	data.SetId(time.Now().UTC().String())
+
+	if err := data.Set("commit", m.(*vault.App).Commit()); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	value, source, err := inDocument(data, m).InRole(role, key)
+
+	if errors.Is(err, vault.ErrKeyNotFound) && isMissingAllowed(data) {
+		if err := setMissingKey(data); err != nil {
+			data.SetId("")
+			return err
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		data.SetId("")
+
+		return vaultError(err)
+	}
+
+	if err := data.Set("value", value); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	if err := data.Set("source", source); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	if err := data.Set("found", true); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	return nil
+}
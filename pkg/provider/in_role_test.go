@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+)
+
+func TestInRoleRead(t *testing.T) {
+	var cases = []struct {
+		intention    string
+		role         string
+		key          string
+		allowMissing bool
+		want         string
+		wantErr      error
+	}{
+		{
+			"vars",
+			"app",
+			"DB_PASSWORD",
+			false,
+			"ROLE_DB_PASSWORD",
+			nil,
+		},
+		{
+			"defaults",
+			"app",
+			"DB_USER",
+			false,
+			"app",
+			nil,
+		},
+		{
+			"allowed missing key",
+			"app",
+			"SECRET_KEY",
+			true,
+			"",
+			nil,
+		},
+		{
+			"not found key",
+			"app",
+			"SECRET_KEY",
+			false,
+			"",
+			errors.New("key `SECRET_KEY` not found in role app"),
+		},
+		{
+			"not found role",
+			"web",
+			"DB_USER",
+			false,
+			"",
+			errors.New("role not found: web in roles"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			data := inRoleResource().Data(nil)
+
+			if err := data.Set("role", testCase.role); err != nil {
+				t.Errorf("unable to set role: %#v", err)
+				return
+			}
+
+			if err := data.Set("key", testCase.key); err != nil {
+				t.Errorf("unable to set key: %#v", err)
+				return
+			}
+
+			if err := data.Set("allow_missing", testCase.allowMissing); err != nil {
+				t.Errorf("unable to set allow_missing: %#v", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			err = inRoleRead(data, vaultApp)
+			result := data.Get("value").(string)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InRoleRead() = (`%s`, %#v), want (`%s`, %#v)", result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
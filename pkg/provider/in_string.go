@@ -1,16 +1,26 @@
 package provider
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"gopkg.in/yaml.v3"
 )
 
+var encValueKeys = []string{"value", "value_map", "value_json"}
+
 func inStringResource() *schema.Resource {
 	return &schema.Resource{
 		Read: inStringRead,
-		Schema: map[string]*schema.Schema{
+		Schema: withFormat(withDocument(withMissingKey(map[string]*schema.Schema{
 			"encrypted": {
 				Type:        schema.TypeString,
 				Description: "Ansible-vault string representation",
@@ -26,21 +36,38 @@ func inStringResource() *schema.Resource {
 				Description: "Vault value found",
 				Type:        schema.TypeString,
 			},
-		},
+		}))),
 	}
 }
 
 func inStringEncResource() *schema.Resource {
 	return &schema.Resource{
+		Create: inStringEncCreate,
 		Read:   inStringEncRead,
-		Create: inStringEncRead,
+		Update: inStringEncUpdate,
 		Delete: inStringEncDelete,
+		Importer: &schema.ResourceImporter{
+			State: inStringEncImport,
+		},
+		CustomizeDiff: inStringEncDiff,
 		Schema: map[string]*schema.Schema{
 			"value": {
-				Required:    true,
-				ForceNew:    true,
-				Description: "Vault value found",
-				Type:        schema.TypeString,
+				Optional:     true,
+				Description:  "Value to encrypt",
+				Type:         schema.TypeString,
+				ExactlyOneOf: encValueKeys,
+			},
+			"value_map": {
+				Optional:    true,
+				Description: "Map of values to encrypt, serialized to yaml",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"value_json": {
+				Optional:     true,
+				Description:  "JSON value to encrypt, serialized to yaml",
+				Type:         schema.TypeString,
+				ValidateFunc: validation.StringIsJSON,
 			},
 			"encrypted": {
 				Computed:    true,
@@ -57,11 +84,20 @@ func inStringRead(data *schema.ResourceData, m interface{}) error {
 
 	data.SetId(time.Now().UTC().String())
 
-	value, err := m.(*vault.App).InString(raw, key)
+	value, err := inFormat(data, m).InString(raw, key)
+
+	if errors.Is(err, vault.ErrKeyNotFound) && isMissingAllowed(data) {
+		if err := setMissingKey(data); err != nil {
+			data.SetId("")
+			return err
+		}
+
+		return nil
+	}
 
 	if err != nil {
 		data.SetId("")
-		return err
+		return vaultError(err)
 	}
 
 	if err := data.Set("value", value); err != nil {
@@ -69,32 +105,104 @@ func inStringRead(data *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
+	if err := data.Set("found", true); err != nil {
+		data.SetId("")
+		return err
+	}
+
 	return nil
 }
 
-func inStringEncRead(data *schema.ResourceData, m interface{}) error {
-	value := data.Get("value").(string)
-	enc := data.Get("encrypted").(string)
-
-	if len(enc) != 0 {
-		dec, err := m.(*vault.App).InString(enc, "")
-		// If there is an error, we need to update it
-		if err == nil {
-			if dec == value {
-				return nil
-			}
+// encValueGetter is implemented by both schema.ResourceData and schema.ResourceDiff
+type encValueGetter interface {
+	Get(string) interface{}
+	GetOk(string) (interface{}, bool)
+}
+
+// encValue returns value to encrypt, structured values being serialized to yaml
+func encValue(data encValueGetter) (string, bool, error) {
+	if rawMap, ok := data.GetOk("value_map"); ok {
+		values := make(map[string]string)
+		for key, value := range rawMap.(map[string]interface{}) {
+			values[key] = value.(string)
 		}
+
+		return marshalYAML(values)
 	}
 
-	data.SetId(time.Now().UTC().String())
+	if rawJSON, ok := data.GetOk("value_json"); ok {
+		var value interface{}
+		if err := json.Unmarshal([]byte(rawJSON.(string)), &value); err != nil {
+			return "", false, fmt.Errorf("value_json: %w", err)
+		}
 
-	encrypted, err := m.(*vault.App).InEncString(value)
+		return marshalYAML(value)
+	}
+
+	return data.Get("value").(string), false, nil
+}
+
+// marshalYAML serializes value to yaml, indented by two spaces as ansible files
+func marshalYAML(value interface{}) (string, bool, error) {
+	var output strings.Builder
+
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(value); err != nil {
+		return "", true, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return "", true, err
+	}
+
+	return strings.TrimSpace(output.String()), true, nil
+}
+
+// sameValue compares decrypted value with the one to encrypt, as parsed yaml if structured
+func sameValue(decrypted string, value string, structured bool) bool {
+	if !structured {
+		return decrypted == value
+	}
 
+	var decryptedContent, content interface{}
+
+	if err := yaml.Unmarshal([]byte(decrypted), &decryptedContent); err != nil {
+		return false
+	}
+
+	if err := yaml.Unmarshal([]byte(value), &content); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(decryptedContent, content)
+}
+
+// isEncrypted checks that encrypted vault still decrypts to the value to encrypt
+func isEncrypted(app *vault.App, encrypted string, value string, structured bool) bool {
+	if len(encrypted) == 0 {
+		return false
+	}
+
+	decrypted, err := app.InString(encrypted, "")
+
+	return err == nil && sameValue(decrypted, value, structured)
+}
+
+func inStringEncCreate(data *schema.ResourceData, m interface{}) error {
+	value, _, err := encValue(data)
 	if err != nil {
-		data.SetId("")
 		return err
 	}
 
+	encrypted, err := m.(*vault.App).InEncString(value)
+	if err != nil {
+		return err
+	}
+
+	data.SetId(time.Now().UTC().String())
+
 	if err := data.Set("encrypted", encrypted); err != nil {
 		data.SetId("")
 		return err
@@ -103,7 +211,83 @@ func inStringEncRead(data *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
+// inStringEncRead fills value from encrypted one when no value is known yet, i.e. after import.
+// Otherwise it has nothing to refresh, encrypted value only lives in state.
+func inStringEncRead(data *schema.ResourceData, m interface{}) error {
+	for _, key := range encValueKeys {
+		if _, ok := data.GetOk(key); ok {
+			return nil
+		}
+	}
+
+	value, err := m.(*vault.App).InString(data.Get("encrypted").(string), "")
+	if err != nil {
+		return vaultError(err)
+	}
+
+	return data.Set("value", value)
+}
+
+func inStringEncUpdate(data *schema.ResourceData, m interface{}) error {
+	value, structured, err := encValue(data)
+	if err != nil {
+		return err
+	}
+
+	if isEncrypted(m.(*vault.App), data.Get("encrypted").(string), value, structured) {
+		return nil
+	}
+
+	encrypted, err := m.(*vault.App).InEncString(value)
+	if err != nil {
+		return err
+	}
+
+	return data.Set("encrypted", encrypted)
+}
+
 func inStringEncDelete(d *schema.ResourceData, m interface{}) error {
 	d.SetId("")
 	return nil
 }
+
+// inStringEncImport imports an existing `$ANSIBLE_VAULT` string given as id, value is filled by read
+func inStringEncImport(data *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	encrypted := data.Id()
+
+	if _, err := m.(*vault.App).InString(encrypted, ""); err != nil {
+		return nil, vaultError(err)
+	}
+
+	if err := data.Set("encrypted", encrypted); err != nil {
+		return nil, err
+	}
+
+	data.SetId(time.Now().UTC().String())
+
+	return []*schema.ResourceData{data}, nil
+}
+
+// inStringEncDiff plans a new encrypted value only when current one doesn't decrypt to the value to encrypt
+func inStringEncDiff(_ context.Context, diff *schema.ResourceDiff, m interface{}) error {
+	if len(diff.Id()) == 0 {
+		return nil
+	}
+
+	for _, key := range encValueKeys {
+		if !diff.NewValueKnown(key) {
+			return diff.SetNewComputed("encrypted")
+		}
+	}
+
+	value, structured, err := encValue(diff)
+	if err != nil {
+		return err
+	}
+
+	if isEncrypted(m.(*vault.App), diff.Get("encrypted").(string), value, structured) {
+		return nil
+	}
+
+	return diff.SetNewComputed("encrypted")
+}
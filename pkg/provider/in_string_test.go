@@ -1,9 +1,13 @@
 package provider
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	ansible_vault "github.com/sosedoff/ansible-vault-go"
 )
 
@@ -23,17 +27,23 @@ func TestInStringRead(t *testing.T) {
 34346433386537313665666233626238613763643132346533376634356435323562`
 
 	var cases = []struct {
-		intention string
-		input     string
-		key       string
-		want      string
-		wantErr   error
+		intention    string
+		input        string
+		key          string
+		defaultValue string
+		allowMissing bool
+		want         string
+		wantFound    bool
+		wantErr      error
 	}{
 		{
 			"simple",
 			vaultRaw,
 			"API_KEY",
+			"",
+			false,
 			"PROD_KEEP_IT_SECRET",
+			true,
 			nil,
 		},
 		{
@@ -41,13 +51,49 @@ func TestInStringRead(t *testing.T) {
 			vaultRaw,
 			"SECRET_KEY",
 			"",
-			vault.ErrKeyNotFound,
+			false,
+			"",
+			false,
+			errors.New("key `SECRET_KEY` not found in <string>"),
 		},
 		{
 			"not provided key",
 			vaultRawString,
 			"",
+			"",
+			false,
+			"PROD_KEEP_IT_SECRET",
+			true,
+			nil,
+		},
+		{
+			"allowed missing key",
+			vaultRaw,
+			"SECRET_KEY",
+			"",
+			true,
+			"",
+			false,
+			nil,
+		},
+		{
+			"default value",
+			vaultRaw,
+			"SECRET_KEY",
+			"fallback",
+			false,
+			"fallback",
+			false,
+			nil,
+		},
+		{
+			"default value not used",
+			vaultRaw,
+			"API_KEY",
+			"fallback",
+			false,
 			"PROD_KEEP_IT_SECRET",
+			true,
 			nil,
 		},
 	}
@@ -66,7 +112,17 @@ func TestInStringRead(t *testing.T) {
 				return
 			}
 
-			vaultApp, err := vault.New("secret", ansibleFolder, "")
+			if err := data.Set("default", testCase.defaultValue); err != nil {
+				t.Errorf("unable to set default: %s", err)
+				return
+			}
+
+			if err := data.Set("allow_missing", testCase.allowMissing); err != nil {
+				t.Errorf("unable to set allow_missing: %s", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
 			if err != nil {
 				t.Errorf("unable to create vault app: %#v", err)
 				return
@@ -74,6 +130,7 @@ func TestInStringRead(t *testing.T) {
 
 			err = inStringRead(data, vaultApp)
 			result := data.Get("value").(string)
+			found := data.Get("found").(bool)
 
 			failed := false
 
@@ -83,46 +140,103 @@ func TestInStringRead(t *testing.T) {
 				failed = true
 			} else if err != nil && err.Error() != testCase.wantErr.Error() {
 				failed = true
-			} else if result != testCase.want {
+			} else if result != testCase.want || found != testCase.wantFound {
 				failed = true
 			}
 
 			if failed {
-				t.Errorf("inStringRead() = (`%s`, %#v), want (`%s`, %#v)", result, err, testCase.want, testCase.wantErr)
+				t.Errorf("inStringRead() = (`%s`, %t, %#v), want (`%s`, %t, %#v)", result, found, err, testCase.want, testCase.wantFound, testCase.wantErr)
 			}
 		})
 	}
 }
 
-func TestInStringEncRead(t *testing.T) {
+func TestInStringEncUpdate(t *testing.T) {
+	existing, err := ansible_vault.Encrypt("api_key: SECRET\nport: 8080", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
 	var cases = []struct {
 		intention string
-		input     string
+		field     string
+		input     interface{}
+		encrypted string
+		want      string
+		wantKept  bool
 		wantErr   error
 	}{
 		{
 			"simple",
+			"value",
+			"PROD_KEEP_IT_SECRET",
+			"",
 			"PROD_KEEP_IT_SECRET",
+			false,
+			nil,
+		},
+		{
+			"map",
+			"value_map",
+			map[string]interface{}{
+				"user":     "admin",
+				"password": "PROD_KEEP_IT_SECRET",
+			},
+			"",
+			"password: PROD_KEEP_IT_SECRET\nuser: admin",
+			false,
+			nil,
+		},
+		{
+			"json",
+			"value_json",
+			`{"port": 8080, "hosts": ["a", "b"]}`,
+			"",
+			"hosts:\n  - a\n  - b\nport: 8080",
+			false,
+			nil,
+		},
+		{
+			"same structure",
+			"value_json",
+			`{"port": 8080, "api_key": "SECRET"}`,
+			existing,
+			"api_key: SECRET\nport: 8080",
+			true,
+			nil,
+		},
+		{
+			"changed structure",
+			"value_json",
+			`{"port": 8081, "api_key": "SECRET"}`,
+			existing,
+			"api_key: SECRET\nport: 8081",
+			false,
 			nil,
 		},
 	}
 
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
-			data := inStringResource().Data(nil)
+			data := inStringEncResource().Data(nil)
 
-			if err := data.Set("value", testCase.input); err != nil {
+			if err := data.Set(testCase.field, testCase.input); err != nil {
 				t.Errorf("unable to set raw value: %s", err)
 				return
 			}
 
-			vaultApp, err := vault.New("secret", ansibleFolder, "")
+			if err := data.Set("encrypted", testCase.encrypted); err != nil {
+				t.Errorf("unable to set encrypted value: %s", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
 			if err != nil {
 				t.Errorf("unable to create vault app: %#v", err)
 				return
 			}
 
-			err = inStringEncRead(data, vaultApp)
+			err = inStringEncUpdate(data, vaultApp)
 			result := data.Get("encrypted").(string)
 
 			failed := false
@@ -135,14 +249,163 @@ func TestInStringEncRead(t *testing.T) {
 				failed = true
 			} else {
 				decValue, err := ansible_vault.Decrypt(result, "secret")
-				if err != nil || decValue != testCase.input {
-					t.Errorf("inStringEncRead() = (`%s`, %#v), want (`%s`, %#v)", result, err, decValue, testCase.wantErr)
-					failed = true
+				if err != nil || strings.TrimSpace(decValue) != testCase.want {
+					t.Errorf("inStringEncUpdate() = (`%s`, %#v), want (`%s`, %#v)", decValue, err, testCase.want, testCase.wantErr)
+				}
+
+				if (result == testCase.encrypted) != testCase.wantKept {
+					t.Errorf("inStringEncUpdate() kept encrypted = %t, want %t", result == testCase.encrypted, testCase.wantKept)
 				}
 			}
 
 			if failed {
-				t.Errorf("inStringEncRead() = (`%s`, %#v), want (%#v)", result, err, testCase.wantErr)
+				t.Errorf("inStringEncUpdate() = (`%s`, %#v), want (%#v)", result, err, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInStringEncImport(t *testing.T) {
+	encrypted, err := ansible_vault.Encrypt("PROD_KEEP_IT_SECRET", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	var cases = []struct {
+		intention string
+		id        string
+		want      string
+		wantErr   error
+	}{
+		{
+			"simple",
+			encrypted,
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"not a vault",
+			"PROD_KEEP_IT_SECRET",
+			"",
+			vault.ErrNotVault,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			data := inStringEncResource().Data(nil)
+			data.SetId(testCase.id)
+
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			_, err = inStringEncImport(data, vaultApp)
+
+			if !errors.Is(err, testCase.wantErr) || (testCase.wantErr == nil && err != nil) {
+				t.Errorf("inStringEncImport() = %v, want %v", err, testCase.wantErr)
+			}
+
+			if result := data.Get("value").(string); result != "" {
+				t.Errorf("inStringEncImport() set value `%s`, want it filled by read", result)
+			}
+
+			if err == nil {
+				if err := inStringEncRead(data, vaultApp); err != nil {
+					t.Errorf("inStringEncRead() = %v, want nil", err)
+				}
+			}
+
+			result := data.Get("value").(string)
+
+			if result != testCase.want {
+				t.Errorf("inStringEncImport() = `%s`, want `%s`", result, testCase.want)
+			}
+
+			if err == nil && data.Get("encrypted").(string) != testCase.id {
+				t.Errorf("inStringEncImport() = `%s`, want `%s`", data.Get("encrypted"), testCase.id)
+			}
+		})
+	}
+}
+
+func TestInStringEncDiff(t *testing.T) {
+	encrypted, err := ansible_vault.Encrypt("PROD_KEEP_IT_SECRET", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	otherEncrypted, err := ansible_vault.Encrypt("PROD_KEEP_IT_SECRET", "other")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	var cases = []struct {
+		intention string
+		encrypted string
+		config    map[string]interface{}
+		want      bool
+	}{
+		{
+			"unchanged",
+			encrypted,
+			map[string]interface{}{"value": "PROD_KEEP_IT_SECRET"},
+			false,
+		},
+		{
+			"changed value",
+			encrypted,
+			map[string]interface{}{"value": "NEW_SECRET"},
+			true,
+		},
+		{
+			"same structure",
+			encrypted,
+			map[string]interface{}{"value_json": `"PROD_KEEP_IT_SECRET"`},
+			false,
+		},
+		{
+			"other password",
+			otherEncrypted,
+			map[string]interface{}{"value": "PROD_KEEP_IT_SECRET"},
+			true,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			vaultApp, err := vault.New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			state := &terraform.InstanceState{
+				ID: "enc_string",
+				Attributes: map[string]string{
+					"id":        "enc_string",
+					"value":     "PROD_KEEP_IT_SECRET",
+					"encrypted": testCase.encrypted,
+				},
+			}
+
+			diff, err := inStringEncResource().Diff(context.Background(), state, terraform.NewResourceConfigRaw(testCase.config), vaultApp)
+			if err != nil {
+				t.Errorf("Diff() = %v", err)
+				return
+			}
+
+			result := false
+			if diff != nil {
+				if attribute, ok := diff.Attributes["encrypted"]; ok {
+					result = attribute.NewComputed
+				}
+			}
+
+			if result != testCase.want {
+				t.Errorf("Diff() encrypted changing = %t, want %t", result, testCase.want)
 			}
 		})
 	}
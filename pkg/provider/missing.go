@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// withMissingKey adds arguments handling a missing key to given data source schema
+func withMissingKey(resourceSchema map[string]*schema.Schema) map[string]*schema.Schema {
+	resourceSchema["default"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Description: "Value used when key is not found, implies allow_missing",
+		Optional:    true,
+	}
+
+	resourceSchema["allow_missing"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Description: "Don't fail when key is not found",
+		Optional:    true,
+		Default:     false,
+	}
+
+	resourceSchema["found"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Description: "Vault key was found",
+		Computed:    true,
+	}
+
+	return resourceSchema
+}
+
+// isMissingAllowed checks if a missing key is allowed, explicitly or by a configured default, even empty
+func isMissingAllowed(data *schema.ResourceData) bool {
+	if data.Get("allow_missing").(bool) {
+		return true
+	}
+
+	// GetOk can't tell an empty default from an unset one, configuration can
+	if rawConfig := data.GetRawConfig(); rawConfig.IsKnown() && !rawConfig.IsNull() && rawConfig.Type().IsObjectType() && rawConfig.Type().HasAttribute("default") {
+		return !rawConfig.GetAttr("default").IsNull()
+	}
+
+	_, ok := data.GetOk("default")
+	return ok
+}
+
+// setMissingKey sets default value and found flag on data
+func setMissingKey(data *schema.ResourceData) error {
+	if err := data.Set("value", data.Get("default").(string)); err != nil {
+		return err
+	}
+
+	return data.Set("found", false)
+}
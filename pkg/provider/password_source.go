@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var passwordSourceKeys = []string{
+	"password_source.0.env",
+	"password_source.0.vault_password_command",
+	"password_source.0.fd",
+	"password_source.0.pass",
+	"password_source.0.hashicorp_vault",
+	"password_source.0.aws_secrets_manager",
+	"password_source.0.aws_ssm",
+}
+
+func passwordSourceSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: "Source of ansible vault pass value, overriding vault_pass and vault_path",
+		Optional:    true,
+		MaxItems:    1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"env": {
+					Type:         schema.TypeString,
+					Description:  "Environment variable containing vault pass",
+					Optional:     true,
+					ExactlyOneOf: passwordSourceKeys,
+				},
+				"vault_password_command": {
+					Type:        schema.TypeList,
+					Description: "Command and its arguments printing vault pass on standard output",
+					Optional:    true,
+					MinItems:    1,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+				"fd": {
+					Type:         schema.TypeInt,
+					Description:  "Open file descriptor containing vault pass, e.g. 3 with `terraform plan 3<password.txt`",
+					Optional:     true,
+					ValidateFunc: validation.IntAtLeast(3),
+				},
+				"pass": {
+					Type:        schema.TypeString,
+					Description: "Entry of the password store containing vault pass",
+					Optional:    true,
+				},
+				"store": {
+					Type:        schema.TypeString,
+					Description: "Password store command, e.g. `gopass`",
+					Optional:    true,
+					Default:     vault.DefaultPasswordStore,
+				},
+				"hashicorp_vault": hashicorpVaultSchema(),
+				"aws_secrets_manager": awsSchema("AWS Secrets Manager secret containing vault pass", map[string]*schema.Schema{
+					"secret_id": {
+						Type:        schema.TypeString,
+						Description: "Name or ARN of secret containing vault pass",
+						Required:    true,
+					},
+					"json_key": {
+						Type:        schema.TypeString,
+						Description: "Key containing vault pass if secret is a JSON object",
+						Optional:    true,
+					},
+				}),
+				"aws_ssm": awsSchema("AWS SSM parameter containing vault pass", map[string]*schema.Schema{
+					"name": {
+						Type:        schema.TypeString,
+						Description: "Name of parameter containing vault pass",
+						Required:    true,
+					},
+				}),
+			},
+		},
+	}
+}
+
+func hashicorpVaultSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: "HashiCorp Vault KV secret containing vault pass",
+		Optional:    true,
+		MaxItems:    1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"address": {
+					Type:        schema.TypeString,
+					Description: "HashiCorp Vault address",
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("VAULT_ADDR", nil),
+				},
+				"path": {
+					Type:        schema.TypeString,
+					Description: "API path of KV secret, e.g. `secret/data/ansible` for KV v2",
+					Required:    true,
+				},
+				"field": {
+					Type:        schema.TypeString,
+					Description: "Field of KV secret containing vault pass",
+					Optional:    true,
+					Default:     vault.DefaultHashicorpVaultField,
+				},
+				"token": {
+					Type:        schema.TypeString,
+					Description: "HashiCorp Vault token",
+					Optional:    true,
+					Sensitive:   true,
+					DefaultFunc: schema.EnvDefaultFunc("VAULT_TOKEN", nil),
+				},
+				"role_id": {
+					Type:        schema.TypeString,
+					Description: "AppRole role id, used when token is empty",
+					Optional:    true,
+				},
+				"secret_id": {
+					Type:        schema.TypeString,
+					Description: "AppRole secret id",
+					Optional:    true,
+					Sensitive:   true,
+				},
+			},
+		},
+	}
+}
+
+// awsSchema adds AWS API settings to given source schema
+func awsSchema(description string, sourceSchema map[string]*schema.Schema) *schema.Schema {
+	sourceSchema["region"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Description: "AWS region, read from `AWS_REGION` or profile if empty",
+		Optional:    true,
+	}
+
+	sourceSchema["profile"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Description: "Profile of AWS shared files, default credentials chain is used if empty",
+		Optional:    true,
+	}
+
+	sourceSchema["endpoint"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Description: "AWS API endpoint override, e.g. for a local stand-in",
+		Optional:    true,
+	}
+
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: description,
+		Optional:    true,
+		MaxItems:    1,
+		Elem: &schema.Resource{
+			Schema: sourceSchema,
+		},
+	}
+}
+
+func newAWSConfig(settings map[string]interface{}) vault.AWSConfig {
+	return vault.AWSConfig{
+		Region:   settings["region"].(string),
+		Profile:  settings["profile"].(string),
+		Endpoint: settings["endpoint"].(string),
+	}
+}
+
+func newPasswordSource(raw []interface{}) vault.PasswordSource {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil
+	}
+
+	source := raw[0].(map[string]interface{})
+
+	if name := source["env"].(string); len(name) != 0 {
+		return vault.EnvPasswordSource{Name: name}
+	}
+
+	if command := source["vault_password_command"].([]interface{}); len(command) != 0 {
+		var args []string
+		for _, arg := range command[1:] {
+			args = append(args, arg.(string))
+		}
+
+		return vault.CommandPasswordSource{Command: command[0].(string), Args: args}
+	}
+
+	if fd := source["fd"].(int); fd != 0 {
+		return vault.FDPasswordSource{FD: fd}
+	}
+
+	if hashicorpVault := source["hashicorp_vault"].([]interface{}); len(hashicorpVault) != 0 && hashicorpVault[0] != nil {
+		settings := hashicorpVault[0].(map[string]interface{})
+
+		return vault.HashicorpVaultPasswordSource{
+			Address:  settings["address"].(string),
+			Path:     settings["path"].(string),
+			Field:    settings["field"].(string),
+			Token:    settings["token"].(string),
+			RoleID:   settings["role_id"].(string),
+			SecretID: settings["secret_id"].(string),
+		}
+	}
+
+	if secretsManager := source["aws_secrets_manager"].([]interface{}); len(secretsManager) != 0 && secretsManager[0] != nil {
+		settings := secretsManager[0].(map[string]interface{})
+
+		return vault.AWSSecretsManagerPasswordSource{
+			AWSConfig: newAWSConfig(settings),
+			SecretID:  settings["secret_id"].(string),
+			JSONKey:   settings["json_key"].(string),
+		}
+	}
+
+	if ssm := source["aws_ssm"].([]interface{}); len(ssm) != 0 && ssm[0] != nil {
+		settings := ssm[0].(map[string]interface{})
+
+		return vault.AWSSSMPasswordSource{
+			AWSConfig: newAWSConfig(settings),
+			Name:      settings["name"].(string),
+		}
+	}
+
+	return vault.StorePasswordSource{Store: source["store"].(string), Entry: source["pass"].(string)}
+}
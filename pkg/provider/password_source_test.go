@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestNewPasswordSource(t *testing.T) {
+	var cases = []struct {
+		intention string
+		input     map[string]interface{}
+		want      vault.PasswordSource
+	}{
+		{
+			"none",
+			nil,
+			nil,
+		},
+		{
+			"env",
+			map[string]interface{}{"env": "VAULT_PASS"},
+			vault.EnvPasswordSource{Name: "VAULT_PASS"},
+		},
+		{
+			"command",
+			map[string]interface{}{"vault_password_command": []interface{}{"./vault-pass.sh", "--vault-id", "prod"}},
+			vault.CommandPasswordSource{Command: "./vault-pass.sh", Args: []string{"--vault-id", "prod"}},
+		},
+		{
+			"file descriptor",
+			map[string]interface{}{"fd": 3},
+			vault.FDPasswordSource{FD: 3},
+		},
+		{
+			"password store",
+			map[string]interface{}{"pass": "infra/ansible-vault", "store": "gopass"},
+			vault.StorePasswordSource{Store: "gopass", Entry: "infra/ansible-vault"},
+		},
+		{
+			"hashicorp vault",
+			map[string]interface{}{
+				"hashicorp_vault": []interface{}{
+					map[string]interface{}{
+						"address":   "http://127.0.0.1:8200",
+						"path":      "secret/data/ansible",
+						"role_id":   "ansible",
+						"secret_id": "approle_secret",
+					},
+				},
+			},
+			vault.HashicorpVaultPasswordSource{
+				Address:  "http://127.0.0.1:8200",
+				Path:     "secret/data/ansible",
+				Field:    vault.DefaultHashicorpVaultField,
+				RoleID:   "ansible",
+				SecretID: "approle_secret",
+			},
+		},
+		{
+			"aws secrets manager",
+			map[string]interface{}{
+				"aws_secrets_manager": []interface{}{
+					map[string]interface{}{
+						"secret_id": "ansible",
+						"json_key":  "vault_pass",
+						"region":    "eu-west-1",
+					},
+				},
+			},
+			vault.AWSSecretsManagerPasswordSource{
+				AWSConfig: vault.AWSConfig{Region: "eu-west-1"},
+				SecretID:  "ansible",
+				JSONKey:   "vault_pass",
+			},
+		},
+		{
+			"aws ssm",
+			map[string]interface{}{
+				"aws_ssm": []interface{}{
+					map[string]interface{}{
+						"name":     "/ansible/vault",
+						"profile":  "ansible",
+						"endpoint": "http://127.0.0.1:4566",
+					},
+				},
+			},
+			vault.AWSSSMPasswordSource{
+				AWSConfig: vault.AWSConfig{Profile: "ansible", Endpoint: "http://127.0.0.1:4566"},
+				Name:      "/ansible/vault",
+			},
+		},
+	}
+
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"root_folder": ansibleFolder,
+			}
+
+			if testCase.input != nil {
+				raw["password_source"] = []interface{}{testCase.input}
+			}
+
+			data := schema.TestResourceDataRaw(t, Provider().Schema, raw)
+
+			if result := newConfig(data).passwordSource; !reflect.DeepEqual(result, testCase.want) {
+				t.Errorf("newPasswordSource() = %#v, want %#v", result, testCase.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,11 @@ package provider
 */
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -31,38 +36,321 @@ func Provider() *schema.Provider {
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("ANSIBLE_VAULT_PATH_PATTERN", nil),
 			},
+			"path_patterns": {
+				Type:        schema.TypeMap,
+				Description: "Named vault path patterns, selected by `pattern` argument of ansiblevault_path_pattern ('path_pattern' is the 'default' one)",
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
 			"vault_pass": {
 				Type:        schema.TypeString,
 				Description: "Ansible vault pass value",
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("ANSIBLE_VAULT_PASS", nil),
 			},
+			"vault_passwords": {
+				Type:        schema.TypeMap,
+				Description: "Additional ansible vault pass values by vault id, tried after vault_pass",
+				Optional:    true,
+				Sensitive:   true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"password_source": passwordSourceSchema(),
 			"root_folder": {
 				Type:        schema.TypeString,
 				Description: "Ansible root directory",
 				Required:    true,
 				DefaultFunc: schema.EnvDefaultFunc("ANSIBLE_ROOT_FOLDER", nil),
 			},
+			"archive": {
+				Type:          schema.TypeString,
+				Description:   "Zip, tar or tar.gz archive of ansible files, e.g. a bundle artifact. root_folder is a path inside of it",
+				Optional:      true,
+				ConflictsWith: []string{"git", "s3"},
+			},
+			"s3": s3Schema(),
+			"git": {
+				Type:        schema.TypeList,
+				Description: "Read vault files at a reference of a git repository instead of working tree",
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ref": {
+							Type:        schema.TypeString,
+							Description: "Git reference, e.g. `origin/main`",
+							Required:    true,
+						},
+						"repository": {
+							Type:        schema.TypeString,
+							Description: "Path of git repository, root_folder if empty",
+							Optional:    true,
+						},
+					},
+				},
+			},
+			"backup_files": {
+				Type:        schema.TypeBool,
+				Description: "Keep a `.bak` copy of vault files before overwriting them",
+				Optional:    true,
+				Default:     false,
+			},
+			"render_templates": {
+				Type:        schema.TypeBool,
+				Description: "Render Jinja2 variable references of values found, e.g. `{{ db_user }}`",
+				Optional:    true,
+				Default:     false,
+			},
+			"lock_timeout": {
+				Type:         schema.TypeString,
+				Description:  "Duration to wait for a vault file locked by another process",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ANSIBLE_VAULT_LOCK_TIMEOUT", vault.DefaultLockTimeout.String()),
+				ValidateFunc: validateDuration,
+			},
+			"allow_outside_root": {
+				Type:        schema.TypeBool,
+				Description: "Allow vault paths resolving outside of root directory",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ANSIBLE_VAULT_ALLOW_OUTSIDE_ROOT", false),
+			},
 		},
 		DataSourcesMap: map[string]*schema.Resource{
 			"ansiblevault_path_pattern": inPathPatternResource(),
 			"ansiblevault_path":         inPathResource(),
+			"ansiblevault_glob":         inGlobResource(),
 			"ansiblevault_string":       inStringResource(),
+			"ansiblevault_role_var":     inRoleResource(),
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"ansiblevault_enc_string": inStringEncResource(),
+			"ansiblevault_rekey":      rekeyResource(),
 		},
 		ConfigureFunc: func(r *schema.ResourceData) (interface{}, error) {
-			return configure(r.Get("vault_path").(string), r.Get("path_pattern").(string), r.Get("vault_pass").(string), r.Get("root_folder").(string))
+			return configure(newConfig(r))
 		},
 	}
 }
 
-func configure(path string, path_pattern string, pass string, rootFolder string) (interface{}, error) {
-	pass, err := vault.GetVaultPassword(path, pass)
+// config of the provider
+type config struct {
+	vaultPath        string
+	pathPattern      string
+	pathPatterns     map[string]string
+	vaultPass        string
+	vaultPasswords   map[string]string
+	passwordSource   vault.PasswordSource
+	rootFolder       string
+	allowOutsideRoot bool
+	backupFiles      bool
+	renderTemplates  bool
+	lockTimeout      time.Duration
+	gitRepository    string
+	gitRef           string
+	archive          string
+	s3               *vault.S3Source
+}
+
+func newConfig(r *schema.ResourceData) config {
+	pathPatterns := make(map[string]string)
+	for name, pattern := range r.Get("path_patterns").(map[string]interface{}) {
+		pathPatterns[name] = pattern.(string)
+	}
+
+	vaultPasswords := make(map[string]string)
+	for id, password := range r.Get("vault_passwords").(map[string]interface{}) {
+		vaultPasswords[id] = password.(string)
+	}
+
+	// lock_timeout is checked by schema validation
+	lockTimeout, _ := time.ParseDuration(r.Get("lock_timeout").(string))
+
+	var gitRepository, gitRef string
+	if gitSettings := r.Get("git").([]interface{}); len(gitSettings) != 0 && gitSettings[0] != nil {
+		settings := gitSettings[0].(map[string]interface{})
+		gitRepository = settings["repository"].(string)
+		gitRef = settings["ref"].(string)
+	}
+
+	var s3 *vault.S3Source
+	if s3Settings := r.Get("s3").([]interface{}); len(s3Settings) != 0 && s3Settings[0] != nil {
+		settings := s3Settings[0].(map[string]interface{})
+		s3 = &vault.S3Source{
+			AWSConfig: newAWSConfig(settings),
+			Bucket:    settings["bucket"].(string),
+			Prefix:    settings["prefix"].(string),
+		}
+	}
+
+	return config{
+		vaultPath:        r.Get("vault_path").(string),
+		pathPattern:      r.Get("path_pattern").(string),
+		pathPatterns:     pathPatterns,
+		vaultPass:        r.Get("vault_pass").(string),
+		vaultPasswords:   vaultPasswords,
+		passwordSource:   newPasswordSource(r.Get("password_source").([]interface{})),
+		rootFolder:       r.Get("root_folder").(string),
+		allowOutsideRoot: r.Get("allow_outside_root").(bool),
+		backupFiles:      r.Get("backup_files").(bool),
+		renderTemplates:  r.Get("render_templates").(bool),
+		lockTimeout:      lockTimeout,
+		gitRepository:    gitRepository,
+		gitRef:           gitRef,
+		archive:          r.Get("archive").(string),
+		s3:               s3,
+	}
+}
+
+func configure(c config) (interface{}, error) {
+	pathPatterns := make(map[string]string, len(c.pathPatterns)+1)
+	for name, pattern := range c.pathPatterns {
+		pathPatterns[name] = pattern
+	}
+
+	if len(c.pathPattern) != 0 {
+		if _, ok := pathPatterns[vault.DefaultPathPattern]; ok {
+			return nil, fmt.Errorf("path_pattern conflicts with `%s` entry of path_patterns", vault.DefaultPathPattern)
+		}
+
+		pathPatterns[vault.DefaultPathPattern] = c.pathPattern
+	}
+
+	path, err := absPath(c.vaultPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rootFolder := c.rootFolder
+
+	// root folder is inside of archive or bucket
+	if len(c.archive) == 0 && c.s3 == nil {
+		if rootFolder, err = absPath(c.rootFolder); err != nil {
+			return nil, err
+		}
+	}
+
+	var passwords []vault.Password
+	for _, id := range sortedKeys(c.vaultPasswords) {
+		passwords = append(passwords, vault.Password{ID: id, Value: c.vaultPasswords[id]})
+	}
+
+	pass, err := vaultPassword(c, path, passwords)
 	if err != nil {
 		return nil, err
 	}
 
-	return vault.New(pass, rootFolder, path_pattern)
+	options := []vault.Option{
+		vault.WithPasswords(passwords...),
+		vault.WithAllowOutsideRoot(c.allowOutsideRoot),
+		vault.WithBackup(c.backupFiles),
+		vault.WithTemplates(c.renderTemplates),
+		vault.WithLockTimeout(c.lockTimeout),
+	}
+
+	if len(c.gitRef) != 0 {
+		repository := rootFolder
+		if len(c.gitRepository) != 0 {
+			if repository, err = absPath(c.gitRepository); err != nil {
+				return nil, err
+			}
+		}
+
+		options = append(options, vault.WithGit(repository, c.gitRef))
+	}
+
+	if len(c.archive) != 0 {
+		archive, err := absPath(c.archive)
+		if err != nil {
+			return nil, err
+		}
+
+		source, err := vault.NewArchiveSource(archive)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, vault.WithSource(source))
+	}
+
+	if c.s3 != nil {
+		options = append(options, vault.WithSource(*c.s3))
+	}
+
+	return vault.New(pass, rootFolder, pathPatterns, options...)
+}
+
+// vaultPassword returns default vault password, from password_source if set
+func vaultPassword(c config, path string, passwords []vault.Password) (string, error) {
+	if c.passwordSource != nil {
+		pass, err := c.passwordSource.Password()
+		if err != nil {
+			return "", fmt.Errorf("password_source: %w", err)
+		}
+
+		return pass, nil
+	}
+
+	pass, err := vault.GetVaultPassword(path, c.vaultPass)
+	if err != nil && (len(passwords) == 0 || len(path) != 0) {
+		return "", err
+	}
+
+	return pass, nil
+}
+
+func s3Schema() *schema.Schema {
+	s3Schema := awsSchema("S3 compatible bucket of ansible files, root_folder is a path inside of prefix", map[string]*schema.Schema{
+		"bucket": {
+			Type:        schema.TypeString,
+			Description: "Bucket name",
+			Required:    true,
+		},
+		"prefix": {
+			Type:        schema.TypeString,
+			Description: "Key prefix of ansible files",
+			Optional:    true,
+		},
+	})
+
+	s3Schema.ConflictsWith = []string{"git"}
+
+	return s3Schema
+}
+
+// absPath expands given path and makes it relative to terraform working directory, the root module
+func absPath(filename string) (string, error) {
+	if len(filename) == 0 {
+		return "", nil
+	}
+
+	expanded, err := vault.ExpandPath(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(expanded)
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func validateDuration(value interface{}, key string) ([]string, []error) {
+	duration, err := time.ParseDuration(value.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", key, err)}
+	}
+
+	if duration < 0 {
+		return nil, []error{fmt.Errorf("%s: duration must not be negative", key)}
+	}
+
+	return nil, nil
 }
@@ -1,7 +1,10 @@
 package provider
 
 import (
-	"reflect"
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
@@ -32,40 +35,175 @@ func TestProvider(t *testing.T) {
 }
 
 func TestConfigure(t *testing.T) {
-	validVault, _ := vault.New("secret", "../../examples/ansible", "")
+	unsupportedArchive, err := filepath.Abs("../../examples/ansible/vault_pass_test.txt")
+	if err != nil {
+		t.Fatalf("unable to get archive path: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(ansibleFolder, "simple_vault_test.yaml"))
+	if err != nil {
+		t.Fatalf("unable to read fixture: %s", err)
+	}
+
+	// `$` of an expanded root folder is kept as is
+	dollarFolder := filepath.Join(t.TempDir(), "ansible$TEST_CONFIGURE_VAULT_PASS")
+	if err := os.Mkdir(dollarFolder, 0700); err != nil {
+		t.Fatalf("unable to create fixture folder: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dollarFolder, "simple_vault_test.yaml"), content, 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	t.Setenv("TEST_CONFIGURE_ROOT_FOLDER", dollarFolder)
+
+	// `~` of a root folder inside of an archive is not the home directory
+	tildeArchive := filepath.Join(t.TempDir(), "ansible.tar")
+	if err := writeTar(tildeArchive, "~/simple_vault_test.yaml", content); err != nil {
+		t.Fatalf("unable to write archive: %s", err)
+	}
 
 	var cases = []struct {
-		intention    string
-		path       	 string
-		path_pattern string
-		pass         string
-		rootFolder   string
-		want         interface{}
-		wantErr      error
+		intention string
+		config    config
+		want      string
+		wantErr   error
 	}{
 		{
 			"erroneous password",
+			config{},
 			"",
+			vault.ErrNoVaultPass,
+		},
+		{
+			"erroneous password",
+			config{
+				vaultPass:  "secret",
+				rootFolder: "../../examples/ansible",
+			},
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"vault password file",
+			config{
+				vaultPath:  "../../examples/ansible/vault_pass_test.txt",
+				rootFolder: "../../examples/ansible",
+			},
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"vault id passwords",
+			config{
+				vaultPasswords: map[string]string{"prod": "secret"},
+				rootFolder:     "../../examples/ansible",
+			},
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"password source",
+			config{
+				vaultPass:      "wrong",
+				passwordSource: vault.EnvPasswordSource{Name: "TEST_CONFIGURE_VAULT_PASS"},
+				rootFolder:     "../../examples/ansible",
+			},
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"erroneous password source",
+			config{
+				passwordSource: vault.EnvPasswordSource{Name: "TEST_CONFIGURE_UNSET_VAULT_PASS"},
+				rootFolder:     "../../examples/ansible",
+			},
 			"",
+			errors.New("password_source: environment variable `TEST_CONFIGURE_UNSET_VAULT_PASS` is not set"),
+		},
+		{
+			"unknown git ref",
+			config{
+				vaultPass:     "secret",
+				rootFolder:    "../../examples/ansible",
+				gitRepository: "../..",
+				gitRef:        "refs/heads/unknown/ref",
+			},
 			"",
+			errors.New("unknown git reference: refs/heads/unknown/ref"),
+		},
+		{
+			"unsupported archive",
+			config{
+				vaultPass:  "secret",
+				rootFolder: "ansible",
+				archive:    "../../examples/ansible/vault_pass_test.txt",
+			},
 			"",
+			errors.New("unsupported archive format: " + unsupportedArchive),
+		},
+		{
+			"root folder expanded once",
+			config{
+				vaultPass:  "secret",
+				rootFolder: "$TEST_CONFIGURE_ROOT_FOLDER",
+			},
+			"NOT_IN_CLEAR_TEXT",
 			nil,
-			vault.ErrNoVaultPass,
 		},
 		{
-			"erroneous password",
+			"archive root folder not expanded",
+			config{
+				vaultPass:  "secret",
+				rootFolder: "~",
+				archive:    tildeArchive,
+			},
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"erroneous path pattern",
+			config{
+				pathPattern: "group_vars/{{ .env }/vault.yml",
+				vaultPass:   "secret",
+				rootFolder:  "../../examples/ansible",
+			},
 			"",
+			errors.New("invalid path pattern: template: path_pattern:1: unexpected \"}\" in operand"),
+		},
+		{
+			"erroneous named path pattern",
+			config{
+				pathPatterns: map[string]string{"host_vars": "host_vars/{{ .host.name }}/vault.yml"},
+				vaultPass:    "secret",
+				rootFolder:   "../../examples/ansible",
+			},
 			"",
-			"secret",
-			"../../examples/ansible",
-			validVault,
-			nil,
+			errors.New("host_vars: invalid path pattern: `.host.name` is not a path parameter"),
+		},
+		{
+			"conflicting path patterns",
+			config{
+				pathPattern:  "group_vars/{{ .env }}/vault.yml",
+				pathPatterns: map[string]string{vault.DefaultPathPattern: "group_vars/{{ .env }}/vault.yml"},
+				vaultPass:    "secret",
+				rootFolder:   "../../examples/ansible",
+			},
+			"",
+			errors.New("path_pattern conflicts with `default` entry of path_patterns"),
 		},
 	}
 
+	t.Setenv("TEST_CONFIGURE_VAULT_PASS", "secret")
+
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
-			result, err := configure(testCase.path, testCase.path_pattern, testCase.pass, testCase.rootFolder)
+			result, err := configure(testCase.config)
+
+			var value string
+			if err == nil {
+				value, err = result.(*vault.App).InPath("simple_vault_test.yaml", "API_KEY")
+			}
 
 			failed := false
 
@@ -75,13 +213,36 @@ func TestConfigure(t *testing.T) {
 				failed = true
 			} else if testCase.wantErr != nil && testCase.wantErr.Error() != err.Error() {
 				failed = true
-			} else if !reflect.DeepEqual(result, testCase.want) {
+			} else if value != testCase.want {
 				failed = true
 			}
 
 			if failed {
-				t.Errorf("Configure() = (%#v, %v), want (%#v, %v)", result, err, testCase.want, testCase.wantErr)
+				t.Errorf("Configure() = (`%s`, %v), want (`%s`, %v)", value, err, testCase.want, testCase.wantErr)
 			}
 		})
 	}
 }
+
+func writeTar(filename string, name string, content []byte) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := tar.NewWriter(file)
+
+	if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
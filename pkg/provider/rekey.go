@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func rekeyResource() *schema.Resource {
+	return &schema.Resource{
+		Create: rekeyCreate,
+		Read:   schema.Noop,
+		Delete: schema.RemoveFromState,
+		Schema: map[string]*schema.Schema{
+			"pattern": {
+				Type:        schema.TypeString,
+				Description: "Glob pattern or directory of vault files to rekey (example: 'group_vars/*/vault.yml')",
+				Required:    true,
+				ForceNew:    true,
+			},
+			"old_password": {
+				Type:          schema.TypeString,
+				Description:   "Current vault password",
+				Optional:      true,
+				ForceNew:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"old_vault_id"},
+			},
+			"old_vault_id": {
+				Type:        schema.TypeString,
+				Description: "Vault id of the current provider password, default one if not set",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"new_password": {
+				Type:         schema.TypeString,
+				Description:  "New vault password",
+				Optional:     true,
+				ForceNew:     true,
+				Sensitive:    true,
+				AtLeastOneOf: []string{"new_password", "new_vault_id"},
+			},
+			"new_vault_id": {
+				Type:        schema.TypeString,
+				Description: "Vault id of the new password, it refers to a provider password if new_password is not set",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"changed_files": {
+				Type:        schema.TypeList,
+				Description: "Vault files re-encrypted, relative to root_folder",
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func rekeyCreate(data *schema.ResourceData, m interface{}) error {
+	app := m.(*vault.App)
+
+	oldPassword, err := rekeyPassword(app, data.Get("old_password").(string), data.Get("old_vault_id").(string))
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := rekeyPassword(app, data.Get("new_password").(string), data.Get("new_vault_id").(string))
+	if err != nil {
+		return err
+	}
+
+	changed, err := app.Rekey(data.Get("pattern").(string), oldPassword, newPassword)
+	if err != nil {
+		return vaultError(err)
+	}
+
+	data.SetId(time.Now().UTC().String())
+
+	if err := data.Set("changed_files", changed); err != nil {
+		data.SetId("")
+		return err
+	}
+
+	return nil
+}
+
+func rekeyPassword(app *vault.App, password string, vaultID string) (vault.Password, error) {
+	if len(password) != 0 {
+		return vault.Password{ID: vaultID, Value: password}, nil
+	}
+
+	return app.Password(vaultID)
+}
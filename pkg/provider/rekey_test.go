@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/MeilleursAgents/terraform-provider-ansiblevault/v2/pkg/vault"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestRekeyCreate(t *testing.T) {
+	rootFolder := t.TempDir()
+
+	content, err := os.ReadFile(path.Join(ansibleFolder, "InPathRead.yml"))
+	if err != nil {
+		t.Fatalf("unable to read fixture: %s", err)
+	}
+
+	if err := os.WriteFile(path.Join(rootFolder, "vault.yml"), content, 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	var cases = []struct {
+		intention   string
+		newPassword string
+		newVaultID  string
+		want        []interface{}
+		wantErr     error
+	}{
+		{
+			"unknown vault id",
+			"",
+			"prod",
+			[]interface{}{},
+			errors.New("unknown vault id: prod"),
+		},
+		{
+			"simple",
+			"new_secret",
+			"",
+			[]interface{}{"vault.yml"},
+			nil,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			data := rekeyResource().Data(nil)
+
+			if err := data.Set("pattern", "*.yml"); err != nil {
+				t.Errorf("unable to set pattern: %#v", err)
+				return
+			}
+
+			if err := data.Set("new_password", testCase.newPassword); err != nil {
+				t.Errorf("unable to set new_password: %#v", err)
+				return
+			}
+
+			if err := data.Set("new_vault_id", testCase.newVaultID); err != nil {
+				t.Errorf("unable to set new_vault_id: %#v", err)
+				return
+			}
+
+			vaultApp, err := vault.New("secret", rootFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create vault app: %#v", err)
+				return
+			}
+
+			err = rekeyCreate(data, vaultApp)
+			result := data.Get("changed_files").([]interface{})
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if !reflect.DeepEqual(result, testCase.want) {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("rekeyCreate() = (%#v, %#v), want (%#v, %#v)", result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestRekeyValidate(t *testing.T) {
+	var cases = []struct {
+		intention string
+		config    map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			"old password",
+			map[string]interface{}{"pattern": "*.yml", "old_password": "secret", "new_password": "new_secret"},
+			false,
+		},
+		{
+			"old vault id",
+			map[string]interface{}{"pattern": "*.yml", "old_vault_id": "dev", "new_vault_id": "prod"},
+			false,
+		},
+		{
+			"old password and vault id",
+			map[string]interface{}{"pattern": "*.yml", "old_password": "secret", "old_vault_id": "dev", "new_vault_id": "prod"},
+			true,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			diags := rekeyResource().Validate(terraform.NewResourceConfigRaw(testCase.config))
+
+			if diags.HasError() != testCase.wantErr {
+				t.Errorf("Validate(%#v) = %#v, want error %t", testCase.config, diags, testCase.wantErr)
+			}
+
+			if diags.HasError() {
+				return
+			}
+
+			data := schema.TestResourceDataRaw(t, rekeyResource().Schema, testCase.config)
+
+			// old_vault_id must not be set behind old_password it conflicts with
+			want, _ := testCase.config["old_vault_id"].(string)
+			if result := data.Get("old_vault_id").(string); result != want {
+				t.Errorf("old_vault_id = `%s`, want `%s`", result, want)
+			}
+		})
+	}
+}
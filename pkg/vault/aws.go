@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+)
+
+// AWSConfig locates AWS API, credentials and region are resolved by the default chain of AWS SDK
+// (environment, shared files of profile, SSO, web identity, container or instance role)
+type AWSConfig struct {
+	Region   string
+	Profile  string
+	Endpoint string
+}
+
+// AWSSecretsManagerPasswordSource reads vault password from an AWS Secrets Manager secret,
+// or from a key of the secret if it is a JSON object
+type AWSSecretsManagerPasswordSource struct {
+	AWSConfig
+	SecretID string
+	JSONKey  string
+}
+
+// Password returns secret string of secret
+func (s AWSSecretsManagerPasswordSource) Password() (string, error) {
+	ctx := context.Background()
+
+	cfg, err := s.load(ctx)
+	if err != nil {
+		return "", fmt.Errorf("aws secretsmanager: %w", err)
+	}
+
+	client := secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		o.BaseEndpoint = s.baseEndpoint()
+	})
+
+	output, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(s.SecretID)})
+	if err != nil {
+		return "", awsError("secretsmanager", err)
+	}
+
+	secret := aws.ToString(output.SecretString)
+
+	if len(s.JSONKey) == 0 {
+		return checkPassword(secret)
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("aws secretsmanager: secret %s is not a JSON object: %w", s.SecretID, err)
+	}
+
+	password, ok := values[s.JSONKey].(string)
+	if !ok {
+		return "", fmt.Errorf("aws secretsmanager: no `%s` string in secret %s", s.JSONKey, s.SecretID)
+	}
+
+	return checkPassword(password)
+}
+
+// AWSSSMPasswordSource reads vault password from an AWS SSM parameter, decrypted if it is a SecureString
+type AWSSSMPasswordSource struct {
+	AWSConfig
+	Name string
+}
+
+// Password returns value of parameter
+func (s AWSSSMPasswordSource) Password() (string, error) {
+	ctx := context.Background()
+
+	cfg, err := s.load(ctx)
+	if err != nil {
+		return "", fmt.Errorf("aws ssm: %w", err)
+	}
+
+	client := ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		o.BaseEndpoint = s.baseEndpoint()
+	})
+
+	output, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(s.Name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", awsError("ssm", err)
+	}
+
+	if output.Parameter == nil {
+		return "", ErrEmptyPassword
+	}
+
+	return checkPassword(aws.ToString(output.Parameter.Value))
+}
+
+// load resolves AWS configuration of profile, explicit region taking precedence
+func (c AWSConfig) load(ctx context.Context) (aws.Config, error) {
+	var options []func(*config.LoadOptions) error
+
+	if len(c.Region) != 0 {
+		options = append(options, config.WithRegion(c.Region))
+	}
+
+	if len(c.Profile) != 0 {
+		options = append(options, config.WithSharedConfigProfile(c.Profile))
+	}
+
+	return config.LoadDefaultConfig(ctx, options...)
+}
+
+// baseEndpoint returns endpoint override of clients, nil to use the resolved one (e.g. from `AWS_ENDPOINT_URL`)
+func (c AWSConfig) baseEndpoint() *string {
+	if len(c.Endpoint) == 0 {
+		return nil
+	}
+
+	return aws.String(strings.TrimRight(c.Endpoint, "/"))
+}
+
+// awsError shortens an API error to its code and message
+func awsError(service string, err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("aws %s: %w", service, err)
+	}
+
+	if message := apiErr.ErrorMessage(); len(message) != 0 {
+		return fmt.Errorf("aws %s: %s: %s", service, apiErr.ErrorCode(), message)
+	}
+
+	return fmt.Errorf("aws %s: %s", service, apiErr.ErrorCode())
+}
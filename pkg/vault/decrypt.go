@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	ansible_vault "github.com/sosedoff/ansible-vault-go"
+)
+
+// DefaultVaultID is the vault id of the provider vault password, as in ansible
+const DefaultVaultID = "default"
+
+const (
+	vaultPrefix  = "$ANSIBLE_VAULT"
+	vaultCipher  = "AES256"
+	vaultHeader  = vaultPrefix + ";1.1;" + vaultCipher
+	envelopeSize = 3
+)
+
+var (
+	// ErrBadHeader occurs when vault header has an unsupported version or cipher
+	ErrBadHeader = errors.New("unsupported vault header")
+
+	// ErrBadEnvelope occurs when vault content is not a valid hex envelope, e.g. mangled by a merge
+	ErrBadEnvelope = errors.New("malformed vault content")
+
+	// ErrBadPadding occurs when vault content is authenticated but can't be decrypted
+	ErrBadPadding = errors.New("corrupted vault content, invalid padding")
+)
+
+// Password is a vault password identified by its vault id
+type Password struct {
+	ID    string
+	Value string
+}
+
+// DecryptError occurs when no password can decrypt the vault
+type DecryptError struct {
+	VaultID string
+	Tried   []string
+	Err     error
+}
+
+func (e *DecryptError) Error() string {
+	message := e.Err.Error()
+
+	if len(e.VaultID) != 0 {
+		message = fmt.Sprintf("%s, encrypted with vault id `%s`", message, e.VaultID)
+	}
+
+	return fmt.Sprintf("%s, tried vault ids: %s", message, strings.Join(e.Tried, ", "))
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+type envelope struct {
+	vaultID string
+	payload string
+}
+
+// parseEnvelope checks vault header and hex envelope, and normalizes it in 1.1 format
+func parseEnvelope(rawVault string) (envelope, error) {
+	lines := strings.SplitN(strings.TrimSpace(rawVault), "\n", 2)
+
+	header := strings.Split(strings.TrimSpace(lines[0]), ";")
+	if header[0] != vaultPrefix || len(lines) != 2 {
+		return envelope{}, ErrNotVault
+	}
+
+	var vaultID string
+
+	switch {
+	case len(header) == 3 && header[1] == "1.1" && header[2] == vaultCipher:
+	case len(header) == 4 && header[1] == "1.2" && header[2] == vaultCipher:
+		vaultID = header[3]
+	default:
+		return envelope{}, fmt.Errorf("%w: %s", ErrBadHeader, strings.TrimSpace(lines[0]))
+	}
+
+	payload := strings.TrimSpace(lines[1])
+	payload = strings.Replace(payload, "\r", "", -1)
+	payload = strings.Replace(payload, "\n", "", -1)
+
+	decoded, err := hex.DecodeString(payload)
+	if err != nil {
+		return envelope{}, fmt.Errorf("%w: %s", ErrBadEnvelope, err)
+	}
+
+	parts := strings.Split(string(decoded), "\n")
+	if len(parts) != envelopeSize {
+		return envelope{}, fmt.Errorf("%w: %d parts instead of %d", ErrBadEnvelope, len(parts), envelopeSize)
+	}
+
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil {
+			return envelope{}, fmt.Errorf("%w: %s", ErrBadEnvelope, err)
+		}
+	}
+
+	return envelope{
+		vaultID: vaultID,
+		payload: vaultHeader + "\n" + payload,
+	}, nil
+}
+
+// orderedPasswords returns passwords with the ones matching vault id first
+func (a App) orderedPasswords(vaultID string) []Password {
+	passwords := make([]Password, 0, len(a.passwords))
+
+	for _, password := range a.passwords {
+		if password.ID == vaultID {
+			passwords = append(passwords, password)
+		}
+	}
+
+	for _, password := range a.passwords {
+		if password.ID != vaultID {
+			passwords = append(passwords, password)
+		}
+	}
+
+	return passwords
+}
+
+// decrypt tries each configured password on the vault, classifying failures
+func (a App) decrypt(rawVault string) (string, error) {
+	vaultEnvelope, err := parseEnvelope(rawVault)
+	if err != nil {
+		return "", err
+	}
+
+	passwords := a.orderedPasswords(vaultEnvelope.vaultID)
+	if len(passwords) == 0 {
+		return "", ErrNoVaultPass
+	}
+
+	tried := make([]string, 0, len(passwords))
+
+	for _, password := range passwords {
+		content, err := ansible_vault.Decrypt(vaultEnvelope.payload, password.Value)
+		if err == nil {
+			return content, nil
+		}
+
+		if errors.Is(err, ansible_vault.ErrInvalidPadding) {
+			return "", ErrBadPadding
+		}
+
+		// HMAC mismatch is reported as invalid password by the library
+		if err.Error() != "invalid password" {
+			return "", err
+		}
+
+		tried = append(tried, password.ID)
+	}
+
+	return "", &DecryptError{
+		VaultID: vaultEnvelope.vaultID,
+		Tried:   tried,
+		Err:     ErrWrongPassword,
+	}
+}
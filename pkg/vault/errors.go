@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+)
+
+// inlineVault is the file name reported in errors of vault given as string
+const inlineVault = "<string>"
+
+var (
+	// ErrWrongPassword occurs when vault can't be decrypted with vault password
+	ErrWrongPassword = errors.New("wrong vault password")
+
+	// ErrNotVault occurs when content is not an ansible vault
+	ErrNotVault = errors.New("not an ansible vault")
+
+	// ErrInvalidYAML occurs when decrypted vault is not a valid yaml
+	ErrInvalidYAML = errors.New("invalid yaml")
+)
+
+// FileError adds vault file context to an error
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileNotFoundError occurs when vault file doesn't exist
+type FileNotFoundError struct {
+	File string
+	Err  error
+}
+
+func (e *FileNotFoundError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// KeyNotFoundError occurs when key is not found in vault, it matches ErrKeyNotFound
+type KeyNotFoundError struct {
+	File    string
+	Key     string
+	Segment string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	if len(e.Segment) != 0 && e.Segment != e.Key {
+		return fmt.Sprintf("key `%s` not found in %s: no `%s` in path", e.Key, e.File, e.Segment)
+	}
+
+	return fmt.Sprintf("key `%s` not found in %s", e.Key, e.File)
+}
+
+// Is makes KeyNotFoundError matching ErrKeyNotFound
+func (e *KeyNotFoundError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+// YAMLError locates an invalid yaml content, it matches ErrInvalidYAML. Column is zero when parser doesn't report it.
+type YAMLError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *YAMLError) Error() string {
+	switch {
+	case e.Line != 0 && e.Column != 0:
+		return fmt.Sprintf("%s: line %d, column %d: %s", ErrInvalidYAML, e.Line, e.Column, e.Message)
+	case e.Line != 0:
+		return fmt.Sprintf("%s: line %d: %s", ErrInvalidYAML, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s: %s", ErrInvalidYAML, e.Message)
+	}
+}
+
+// Is makes YAMLError matching ErrInvalidYAML
+func (e *YAMLError) Is(target error) bool {
+	return target == ErrInvalidYAML
+}
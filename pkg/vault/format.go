@@ -0,0 +1,293 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FormatYAML parses decrypted payload as yaml, keys are dotted paths
+	FormatYAML = "yaml"
+
+	// FormatJSON parses decrypted payload as a JSON object, keys are dotted paths
+	FormatJSON = "json"
+
+	// FormatDotenv parses decrypted payload as `KEY=value` lines
+	FormatDotenv = "dotenv"
+
+	// FormatINI parses decrypted payload as ini, keys are `section.key` or `key` before any section
+	FormatINI = "ini"
+
+	// FormatRaw returns decrypted payload as is, without key
+	FormatRaw = "raw"
+)
+
+// Formats lists supported payload formats
+var Formats = []string{FormatYAML, FormatJSON, FormatDotenv, FormatINI, FormatRaw}
+
+var (
+	// ErrUnknownFormat occurs when payload format is not supported
+	ErrUnknownFormat = errors.New("unknown format")
+
+	// ErrInvalidJSON occurs when decrypted vault is not a valid JSON object
+	ErrInvalidJSON = errors.New("invalid json")
+
+	// ErrInvalidDotenv occurs when decrypted vault is not a valid dotenv file
+	ErrInvalidDotenv = errors.New("invalid dotenv")
+
+	// ErrUnsupportedDocument occurs when a document other than the first one is read in a format without documents
+	ErrUnsupportedDocument = errors.New("document is only supported with yaml format")
+)
+
+// InFormat returns a copy of App parsing decrypted vault files with given format, detected from file extension if empty
+func (a App) InFormat(format string) App {
+	a.format = format
+
+	return a
+}
+
+// fileFormat returns payload format of file, only yaml supporting a document other than the first one
+func (a App) fileFormat(filename string) (string, error) {
+	format := a.format
+
+	if len(format) == 0 {
+		format = detectFormat(filename)
+	} else if !isFormat(format) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	if a.document != 0 && format != FormatYAML {
+		return "", &FileError{File: filename, Err: fmt.Errorf("%w, not %s", ErrUnsupportedDocument, format)}
+	}
+
+	return format, nil
+}
+
+func isFormat(format string) bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectFormat guesses payload format from file extension, yaml by default, e.g. for `.env.yml`
+func detectFormat(filename string) string {
+	base := path.Base(filename)
+
+	switch {
+	case strings.HasSuffix(base, ".json"):
+		return FormatJSON
+	case strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml"):
+		return FormatYAML
+	case strings.HasSuffix(base, ".env") || strings.HasPrefix(base, ".env."):
+		return FormatDotenv
+	case strings.HasSuffix(base, ".ini") || strings.HasSuffix(base, ".cfg"):
+		return FormatINI
+	default:
+		return FormatYAML
+	}
+}
+
+// getPayloadKey returns value of key in decrypted payload, whole payload if key is empty
+func getPayloadKey(filename string, content string, key string, format string, document int) (string, error) {
+	if format == FormatYAML {
+		return getYAMLKey(filename, content, key, document)
+	}
+
+	if len(strings.TrimSpace(key)) == 0 {
+		return strings.Trim(content, "\n"), nil
+	}
+
+	switch format {
+	case FormatJSON:
+		return getJSONKey(filename, content, key)
+	case FormatDotenv:
+		values, err := parseDotenv(content)
+		if err != nil {
+			return "", &FileError{File: filename, Err: err}
+		}
+
+		value, ok := values[key]
+		if !ok {
+			return "", &KeyNotFoundError{File: filename, Key: key}
+		}
+
+		return value, nil
+	case FormatINI:
+		section, name := "", key
+		if index := strings.LastIndex(key, "."); index != -1 {
+			section, name = key[:index], key[index+1:]
+		}
+
+		value, ok := parseINISection(content, section)[name]
+		if !ok {
+			return "", &KeyNotFoundError{File: filename, Key: key}
+		}
+
+		return value, nil
+	default:
+		return "", &FileError{File: filename, Err: fmt.Errorf("key `%s` can't be read in %s format", key, format)}
+	}
+}
+
+func getJSONKey(filename string, content string, key string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return "", &FileError{File: filename, Err: fmt.Errorf("%w: %s", ErrInvalidJSON, err)}
+	}
+
+	object, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", &FileError{File: filename, Err: fmt.Errorf("%w: payload is not an object", ErrInvalidJSON)}
+	}
+
+	keys := strings.Split(key, ".")
+	for i, k := range keys {
+		last := i == len(keys)-1
+
+		switch v := object[k].(type) {
+		case map[string]interface{}:
+			if !last {
+				object = v
+				continue
+			}
+		case string:
+			if last {
+				return strings.Trim(v, "\n"), nil
+			}
+		case json.Number:
+			if last {
+				return v.String(), nil
+			}
+		case bool:
+			if last {
+				return strconv.FormatBool(v), nil
+			}
+		}
+
+		return "", &KeyNotFoundError{File: filename, Key: key, Segment: k}
+	}
+
+	return "", &KeyNotFoundError{File: filename, Key: key}
+}
+
+// parseDotenv parses `KEY=value` lines, optionally prefixed by `export`. Values may be single quoted, kept as is,
+// or double quoted, with `\n`, `\"` and `\\` escapes. Unquoted values end at ` #` comments.
+func parseDotenv(content string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for index, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		name := strings.TrimSpace(parts[0])
+
+		if len(parts) != 2 || len(name) == 0 || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%w: line %d: expected `KEY=value`", ErrInvalidDotenv, index+1)
+		}
+
+		value, err := dotenvValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidDotenv, index+1, err)
+		}
+
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+func dotenvValue(raw string) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'':
+		end := strings.IndexByte(raw[1:], quote)
+		if end == -1 {
+			return "", errors.New("unclosed single quote")
+		}
+
+		return raw[1 : end+1], nil
+	case '"':
+		var value strings.Builder
+
+		for i := 1; i < len(raw); i++ {
+			switch char := raw[i]; {
+			case char == '"':
+				return value.String(), nil
+			case char == '\\' && i+1 < len(raw):
+				i++
+
+				if raw[i] == 'n' {
+					value.WriteByte('\n')
+				} else {
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(char)
+			}
+		}
+
+		return "", errors.New("unclosed double quote")
+	default:
+		if index := strings.Index(raw, " #"); index != -1 {
+			raw = raw[:index]
+		}
+
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// payloadVars returns top level variables of decrypted payload, for rendering templates
+func payloadVars(content string, format string, document int) map[string]interface{} {
+	vars := make(map[string]interface{})
+
+	switch format {
+	case FormatYAML:
+		return yamlVars(content, document)
+	case FormatJSON:
+		_ = json.Unmarshal([]byte(content), &vars)
+	case FormatDotenv:
+		values, _ := parseDotenv(content)
+		for name, value := range values {
+			vars[name] = value
+		}
+	case FormatINI:
+		for name, value := range parseINISection(content, "") {
+			vars[name] = value
+		}
+
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+
+			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+				section := strings.TrimSpace(line[1 : len(line)-1])
+				values := make(map[string]interface{})
+
+				for name, value := range parseINISection(content, section) {
+					values[name] = value
+				}
+
+				vars[section] = values
+			}
+		}
+	}
+
+	return vars
+}
@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrUnknownGitRef occurs when git reference doesn't resolve to a commit
+	ErrUnknownGitRef = errors.New("unknown git reference")
+
+	// ErrGitUnsupported occurs when a lookup can't be done on a git source
+	ErrGitUnsupported = errors.New("not supported with git source")
+)
+
+// gitSource reads vault files from a commit of a git repository, through go-git without git binary
+type gitSource struct {
+	repository string
+	ref        string
+	commit     string
+	tree       *object.Tree
+}
+
+// WithGit reads vault files at ref of local git repository instead of working tree
+func WithGit(repository string, ref string) Option {
+	return WithSource(&gitSource{
+		repository: repository,
+		ref:        ref,
+	})
+}
+
+// Commit returns commit SHA of git source, empty if vault files are not read from git
+func (a App) Commit() string {
+	if git, ok := a.source.(*gitSource); ok {
+		return git.commit
+	}
+
+	return ""
+}
+
+func (*gitSource) localPaths() {}
+
+// resolve resolves ref of git source to a commit and its tree
+func (g *gitSource) resolve() error {
+	var err error
+
+	g.repository, err = canonicalPath(g.repository)
+	if err != nil {
+		return err
+	}
+
+	repository, err := git.PlainOpen(g.repository)
+	if err != nil {
+		return fmt.Errorf("git repository %s: %w", g.repository, err)
+	}
+
+	hash, err := repository.ResolveRevision(plumbing.Revision(g.ref))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownGitRef, g.ref)
+	}
+
+	commit, err := repository.CommitObject(*hash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		// annotated tag points to its tag object
+		if tag, tagErr := repository.TagObject(*hash); tagErr == nil {
+			commit, err = tag.Commit()
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownGitRef, g.ref)
+	}
+
+	g.commit = commit.Hash.String()
+
+	g.tree, err = commit.Tree()
+
+	return err
+}
+
+// Open reads file content at commit, file being an absolute path in repository
+func (g *gitSource) Open(name string) (io.ReadCloser, error) {
+	relPath, err := g.relativePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := g.tree.File(relPath)
+	if err != nil {
+		return nil, g.notFound(relPath, err)
+	}
+
+	return file.Reader()
+}
+
+// Stat describes file or directory at commit
+func (g *gitSource) Stat(name string) (fs.FileInfo, error) {
+	relPath, err := g.relativePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if relPath == "." {
+		return sourceFileInfo{name: relPath, dir: true}, nil
+	}
+
+	entry, err := g.tree.FindEntry(relPath)
+	if err != nil {
+		return nil, g.notFound(relPath, err)
+	}
+
+	if entry.Mode == filemode.Dir {
+		return sourceFileInfo{name: relPath, dir: true}, nil
+	}
+
+	file, err := g.tree.File(relPath)
+	if err != nil {
+		return nil, g.notFound(relPath, err)
+	}
+
+	return sourceFileInfo{name: relPath, size: file.Size}, nil
+}
+
+// List is not supported
+func (g *gitSource) List(pattern string) ([]string, error) {
+	return nil, fmt.Errorf("glob %w", ErrGitUnsupported)
+}
+
+// relativePath returns slash separated path of file relative to repository
+func (g *gitSource) relativePath(name string) (string, error) {
+	fullPath, err := canonicalPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(g.repository, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of git repository %s", name, g.repository)
+	}
+
+	return filepath.ToSlash(relPath), nil
+}
+
+// notFound converts a missing tree entry to an os.ErrNotExist error
+func (g *gitSource) notFound(relPath string, err error) error {
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return &os.PathError{Op: "open", Path: g.ref + ":" + relPath, Err: os.ErrNotExist}
+	}
+
+	return err
+}
@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHashicorpVaultField is the secret field containing vault password when none is given
+const DefaultHashicorpVaultField = "password"
+
+var hashicorpVaultClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// HashicorpVaultPasswordSource reads vault password from a HashiCorp Vault KV secret, v1 or v2.
+// Path is the API path of the secret, e.g. `secret/data/ansible` for KV v2 or `secret/ansible` for KV v1.
+// It authenticates with Token or, if empty, with AppRole credentials.
+type HashicorpVaultPasswordSource struct {
+	Address  string
+	Path     string
+	Field    string
+	Token    string
+	RoleID   string
+	SecretID string
+}
+
+type hashicorpVaultResponse struct {
+	Errors []string `json:"errors"`
+	Auth   struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Password reads field of KV secret
+func (s HashicorpVaultPasswordSource) Password() (string, error) {
+	token := s.Token
+
+	if len(token) == 0 {
+		if len(s.RoleID) == 0 {
+			return "", fmt.Errorf("hashicorp vault: token or approle role id is required")
+		}
+
+		var err error
+		token, err = s.login()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var response hashicorpVaultResponse
+	if err := s.request(http.MethodGet, s.Path, token, nil, &response); err != nil {
+		return "", err
+	}
+
+	data := response.Data
+
+	// KV v2 nests secret in data, next to its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	field := s.Field
+	if len(field) == 0 {
+		field = DefaultHashicorpVaultField
+	}
+
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("hashicorp vault: no `%s` field in %s", field, s.Path)
+	}
+
+	password, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("hashicorp vault: `%s` field of %s is not a string", field, s.Path)
+	}
+
+	return checkPassword(password)
+}
+
+func (s HashicorpVaultPasswordSource) login() (string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"role_id":   s.RoleID,
+		"secret_id": s.SecretID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var response hashicorpVaultResponse
+	if err := s.request(http.MethodPost, "auth/approle/login", "", payload, &response); err != nil {
+		return "", err
+	}
+
+	if len(response.Auth.ClientToken) == 0 {
+		return "", fmt.Errorf("hashicorp vault: no token returned by approle login")
+	}
+
+	return response.Auth.ClientToken, nil
+}
+
+func (s HashicorpVaultPasswordSource) request(method string, path string, token string, payload []byte, response *hashicorpVaultResponse) error {
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(s.Address, "/"), strings.TrimLeft(path, "/"))
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return fmt.Errorf("hashicorp vault: %w", err)
+	}
+
+	if len(token) != 0 {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := hashicorpVaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("hashicorp vault: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	decodeErr := json.NewDecoder(resp.Body).Decode(response)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(response.Errors) != 0 {
+			return fmt.Errorf("hashicorp vault: %s: %s: %s", path, resp.Status, strings.Join(response.Errors, ", "))
+		}
+
+		return fmt.Errorf("hashicorp vault: %s: %s", path, resp.Status)
+	}
+
+	if decodeErr != nil {
+		return fmt.Errorf("hashicorp vault: invalid response from %s: %w", path, decodeErr)
+	}
+
+	return nil
+}
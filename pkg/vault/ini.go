@@ -0,0 +1,32 @@
+package vault
+
+import (
+	"strings"
+)
+
+// parseINISection parses `key = value` or `key: value` lines of a section of an ini content, keys before any section
+// if name is empty
+func parseINISection(content string, name string) map[string]string {
+	values := make(map[string]string)
+	inSection := len(name) == 0
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == name
+			continue
+		}
+
+		// first `=` or `:` delimits key, as python configparser
+		if index := strings.IndexAny(line, "=:"); inSection && index != -1 {
+			values[strings.TrimSpace(line[:index])] = strings.TrimSpace(line[index+1:])
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is the default duration to wait for a locked vault file
+const DefaultLockTimeout = 10 * time.Second
+
+// lockRetryInterval is the duration between two lock attempts
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrLocked occurs when vault file lock is held by another process after lock timeout
+var ErrLocked = errors.New("vault file is locked by another process")
+
+// WithLockTimeout sets the duration to wait for a locked vault file
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(a *App) {
+		a.lockTimeout = timeout
+	}
+}
+
+// lockFolder returns the folder of lock files, per user in temporary directory, keeping them out of ansible tree
+func lockFolder() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("terraform-provider-ansiblevault-%d", os.Getuid()))
+}
+
+// lockFilename returns name of the lock file of a vault file, keyed by its canonical path. Vault file itself can't
+// be locked: it is replaced on write, waiters would then hold a lock on the removed file.
+func lockFilename(filename string) (string, error) {
+	fullPath, err := canonicalPath(filename)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(fullPath))
+
+	return filepath.Join(lockFolder(), hex.EncodeToString(hash[:])+".lock"), nil
+}
+
+// lockFile acquires an advisory lock on lock file of filename, shared for reading or exclusive for writing.
+// Lock file is created by writers only and never removed: a reader finding none has no writer to wait for, a write
+// replacing vault file atomically. Returned function releases the lock.
+func (a App) lockFile(filename string, exclusive bool) (func(), error) {
+	// vault file is checked first, for errors to refer to it rather than to its lock file
+	vaultFile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = vaultFile.Close()
+
+	lockName, err := lockFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	flag := os.O_RDONLY
+	if exclusive {
+		if err := os.MkdirAll(lockFolder(), 0700); err != nil {
+			return nil, err
+		}
+
+		flag |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(lockName, flag, 0600)
+	if err != nil && !exclusive && errors.Is(err, fs.ErrNotExist) {
+		return func() {}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(a.lockTimeout)
+
+	for {
+		locked, err := tryLock(file, exclusive)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+
+		if locked {
+			return func() {
+				_ = unlock(file)
+				_ = file.Close()
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			_ = file.Close()
+			return nil, fmt.Errorf("%w, gave up after %s", ErrLocked, a.lockTimeout)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// readLockedFile reads file while holding a shared lock on it
+func (a App) readLockedFile(filename string) (string, error) {
+	unlockFile, err := a.lockFile(filename, false)
+	if err != nil {
+		return "", err
+	}
+
+	defer unlockFile()
+
+	return readSourceFile(a.source, filename)
+}
+
+// readVaultFile reads vault file from source, with a shared lock on local file system
+func (a App) readVaultFile(filename string) (string, error) {
+	if _, ok := a.source.(localFiles); ok {
+		return a.readLockedFile(filename)
+	}
+
+	return readSourceFile(a.source, filename)
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package vault
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock acquires a flock on file without blocking, it returns false if lock is held by someone else
+func tryLock(file *os.File, exclusive bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
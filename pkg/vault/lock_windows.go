@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package vault
+
+import (
+	"os"
+)
+
+// tryLock is not supported on windows, vault files are not locked
+func tryLock(_ *os.File, _ bool) (bool, error) {
+	return true, nil
+}
+
+func unlock(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultPasswordStore is the password store command used when none is given
+const DefaultPasswordStore = "pass"
+
+// terraformPluginCookie is the environment variable set by Terraform in provider processes it starts
+const terraformPluginCookie = "TF_PLUGIN_MAGIC_COOKIE"
+
+// ErrEmptyPassword occurs when password source returns an empty password
+var ErrEmptyPassword = errors.New("empty vault password")
+
+// PasswordSource retrieves a vault password
+type PasswordSource interface {
+	Password() (string, error)
+}
+
+// EnvPasswordSource reads vault password from an environment variable
+type EnvPasswordSource struct {
+	Name string
+}
+
+// Password returns content of environment variable
+func (s EnvPasswordSource) Password() (string, error) {
+	value, ok := os.LookupEnv(s.Name)
+	if !ok {
+		return "", fmt.Errorf("environment variable `%s` is not set", s.Name)
+	}
+
+	return checkPassword(value)
+}
+
+// CommandPasswordSource reads vault password from standard output of a command, as ansible vault password scripts
+type CommandPasswordSource struct {
+	Command string
+	Args    []string
+}
+
+// Password runs command and returns its first output line
+func (s CommandPasswordSource) Password() (string, error) {
+	output, err := runCommand(s.Command, s.Args...)
+	if err != nil {
+		return "", err
+	}
+
+	return checkPassword(firstLine(output))
+}
+
+// FDPasswordSource reads vault password from an open file descriptor, e.g. `3` with `terraform plan 3<password.txt`,
+// without going through stdin. Terraform doesn't pass extra descriptors to providers it starts: the descriptor of the
+// parent Terraform process is read then, through `/proc` on Linux.
+type FDPasswordSource struct {
+	FD int
+}
+
+// Password reads file descriptor until its end
+func (s FDPasswordSource) Password() (string, error) {
+	data, err := ioutil.ReadFile(s.path())
+	if err != nil {
+		return "", fmt.Errorf("unable to read file descriptor %d: %w", s.FD, err)
+	}
+
+	return checkPassword(strings.TrimRight(string(data), "\r\n"))
+}
+
+// path returns path of file descriptor, of the parent process when running as a Terraform provider
+func (s FDPasswordSource) path() string {
+	if _, ok := os.LookupEnv(terraformPluginCookie); ok {
+		return fmt.Sprintf("/proc/%d/fd/%d", os.Getppid(), s.FD)
+	}
+
+	return fmt.Sprintf("/dev/fd/%d", s.FD)
+}
+
+// StorePasswordSource reads vault password from a `pass` compatible password store, e.g. `gopass`
+type StorePasswordSource struct {
+	Store string
+	Entry string
+}
+
+// Password returns first line of password store entry
+func (s StorePasswordSource) Password() (string, error) {
+	store := s.Store
+	if len(store) == 0 {
+		store = DefaultPasswordStore
+	}
+
+	output, err := runCommand(store, "show", s.Entry)
+	if err != nil {
+		return "", err
+	}
+
+	return checkPassword(firstLine(output))
+}
+
+func runCommand(command string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); len(message) != 0 {
+			return "", fmt.Errorf("%s: %w: %s", command, err, message)
+		}
+
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+
+	return stdout.String(), nil
+}
+
+func firstLine(output string) string {
+	return strings.TrimRight(strings.SplitN(output, "\n", 2)[0], "\r")
+}
+
+func checkPassword(password string) (string, error) {
+	if len(password) == 0 {
+		return "", ErrEmptyPassword
+	}
+
+	return password, nil
+}
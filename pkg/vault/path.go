@@ -0,0 +1,163 @@
+package vault
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// OutsideRootError occurs when a vault path resolves outside of root folder
+type OutsideRootError struct {
+	Path string
+	Root string
+}
+
+func (e *OutsideRootError) Error() string {
+	return fmt.Sprintf("%s is outside of root folder %s", e.Path, e.Root)
+}
+
+// ExpandPath expands leading `~` to user home directory and `$VAR` or `${VAR}` to environment values
+func ExpandPath(filename string) (string, error) {
+	return expandHome(os.ExpandEnv(filename))
+}
+
+// isHomePath checks if path is relative to user home directory, i.e. `~` or starting with `~/`
+func isHomePath(filename string) bool {
+	return filename == "~" || strings.HasPrefix(filename, "~/")
+}
+
+// expandHome expands leading `~` to user home directory
+func expandHome(filename string) (string, error) {
+	if !isHomePath(filename) {
+		return filename, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(home, strings.TrimPrefix(filename, "~")), nil
+}
+
+// WithAllowOutsideRoot allows vault paths resolving outside of root folder
+func WithAllowOutsideRoot(allowOutsideRoot bool) Option {
+	return func(a *App) {
+		a.allowOutsideRoot = allowOutsideRoot
+	}
+}
+
+// resolvePath joins given path to root folder and ensures that it stays inside, symlinks included.
+// Only leading `~` is expanded, environment variables are expanded in provider paths only.
+func (a App) resolvePath(vaultPath string) (string, error) {
+	if _, ok := a.source.(localPaths); !ok {
+		return a.resolveSourcePath(vaultPath)
+	}
+
+	fullPath := path.Join(a.rootFolder, vaultPath)
+
+	// home relative path is explicit, we don't prefix it with root folder
+	if isHomePath(vaultPath) {
+		expandedPath, err := expandHome(vaultPath)
+		if err != nil {
+			return "", err
+		}
+
+		fullPath = expandedPath
+	}
+
+	if err := a.checkInRoot(fullPath); err != nil {
+		return "", err
+	}
+
+	return fullPath, nil
+}
+
+// resolveSourcePath joins given path to root folder of a source addressing files relatively to its root
+func (a App) resolveSourcePath(vaultPath string) (string, error) {
+	name := path.Join(filepath.ToSlash(a.rootFolder), filepath.ToSlash(vaultPath))
+
+	if !fs.ValidPath(name) {
+		return "", &OutsideRootError{Path: vaultPath, Root: a.rootFolder}
+	}
+
+	if err := a.checkInRoot(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// relativePath returns path of file relative to root folder, full path if it is outside of it
+func (a App) relativePath(fullPath string) string {
+	relPath, err := filepath.Rel(a.rootFolder, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return fullPath
+	}
+
+	return filepath.ToSlash(relPath)
+}
+
+func (a App) checkInRoot(fullPath string) error {
+	if a.allowOutsideRoot {
+		return nil
+	}
+
+	if _, ok := a.source.(localPaths); !ok {
+		root := path.Clean(filepath.ToSlash(a.rootFolder))
+		if root != "." && fullPath != root && !strings.HasPrefix(fullPath, root+"/") {
+			return &OutsideRootError{Path: fullPath, Root: a.rootFolder}
+		}
+
+		return nil
+	}
+
+	root, err := canonicalPath(a.rootFolder)
+	if err != nil {
+		return err
+	}
+
+	target, err := canonicalPath(fullPath)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &OutsideRootError{Path: fullPath, Root: a.rootFolder}
+	}
+
+	return nil
+}
+
+// canonicalPath returns absolute path with symlinks evaluated, even for a not existing file
+func canonicalPath(filename string) (string, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err == nil {
+		return resolved, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(absPath)
+	if parent == absPath {
+		return absPath, nil
+	}
+
+	resolvedParent, err := canonicalPath(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resolvedParent, filepath.Base(absPath)), nil
+}
@@ -0,0 +1,230 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// DefaultPathPattern is the name of path pattern used when none is selected
+const DefaultPathPattern = "default"
+
+var (
+	// ErrInvalidPathPattern occurs when path pattern references something else than path parameters
+	ErrInvalidPathPattern = errors.New("invalid path pattern")
+
+	// ErrUnknownPathPattern occurs when selected path pattern is not configured
+	ErrUnknownPathPattern = errors.New("unknown path pattern")
+)
+
+var patternFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": replaceFunc,
+	"default": defaultFunc,
+	"env":     os.Getenv,
+	"join":    joinFunc,
+}
+
+// pathPattern is a parsed path pattern
+type pathPattern struct {
+	template *template.Template
+
+	// optionalParams are parameters only used as `default` value, they can be omitted
+	optionalParams []string
+}
+
+func parsePathPatterns(rawPatterns map[string]string) (map[string]pathPattern, error) {
+	patterns := make(map[string]pathPattern, len(rawPatterns))
+
+	for name, rawPattern := range rawPatterns {
+		if len(rawPattern) == 0 {
+			continue
+		}
+
+		pattern, err := parsePathPattern(rawPattern)
+		if err != nil {
+			if name != DefaultPathPattern {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			return nil, err
+		}
+
+		patterns[name] = pattern
+	}
+
+	return patterns, nil
+}
+
+func parsePathPattern(rawPattern string) (pathPattern, error) {
+	tmpl, err := template.New("path_pattern").Option("missingkey=error").Funcs(patternFuncs).Parse(rawPattern)
+	if err != nil {
+		return pathPattern{}, fmt.Errorf("%w: %s", ErrInvalidPathPattern, err)
+	}
+
+	pattern := pathPattern{
+		template: tmpl,
+	}
+
+	if tmpl.Tree == nil {
+		return pattern, nil
+	}
+
+	params := patternParams{
+		required: make(map[string]bool),
+		optional: make(map[string]bool),
+	}
+
+	if err := params.check(tmpl.Tree.Root); err != nil {
+		return pathPattern{}, err
+	}
+
+	for param := range params.optional {
+		if !params.required[param] {
+			pattern.optionalParams = append(pattern.optionalParams, param)
+		}
+	}
+
+	return pattern, nil
+}
+
+func (p pathPattern) render(pathParams map[string]interface{}) (string, error) {
+	params := make(map[string]interface{}, len(pathParams)+len(p.optionalParams))
+	for _, param := range p.optionalParams {
+		params[param] = ""
+	}
+
+	for key, value := range pathParams {
+		params[key] = value
+	}
+
+	var buffer bytes.Buffer
+	if err := p.template.Execute(&buffer, params); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+type patternParams struct {
+	required map[string]bool
+	optional map[string]bool
+}
+
+// check ensures that template only references first level path parameters
+func (p patternParams) check(node parse.Node) error {
+	switch n := node.(type) {
+	case nil, *parse.TextNode, *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.IdentifierNode:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, child := range n.Nodes {
+			if err := p.check(child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case *parse.ActionNode:
+		return p.check(n.Pipe)
+	case *parse.IfNode:
+		if err := p.check(n.Pipe); err != nil {
+			return err
+		}
+
+		if err := p.check(n.List); err != nil {
+			return err
+		}
+
+		return p.check(n.ElseList)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+
+		if len(n.Decl) != 0 {
+			return fmt.Errorf("%w: variable declaration is not allowed in `%s`", ErrInvalidPathPattern, n)
+		}
+
+		for i, cmd := range n.Cmds {
+			// `{{ .param | default "value" }}`
+			if i+1 < len(n.Cmds) && len(cmd.Args) == 1 && isDefaultCommand(n.Cmds[i+1]) {
+				if field, ok := cmd.Args[0].(*parse.FieldNode); ok && len(field.Ident) == 1 {
+					p.optional[field.Ident[0]] = true
+					continue
+				}
+			}
+
+			if err := p.check(cmd); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			// `{{ default "value" .param }}`
+			if i == len(n.Args)-1 && i > 0 && isDefaultCommand(n) {
+				if field, ok := arg.(*parse.FieldNode); ok && len(field.Ident) == 1 {
+					p.optional[field.Ident[0]] = true
+					continue
+				}
+			}
+
+			if err := p.check(arg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case *parse.FieldNode:
+		if len(n.Ident) != 1 {
+			return fmt.Errorf("%w: `%s` is not a path parameter", ErrInvalidPathPattern, n)
+		}
+
+		p.required[n.Ident[0]] = true
+
+		return nil
+	default:
+		return fmt.Errorf("%w: `%s` is not a path parameter", ErrInvalidPathPattern, n)
+	}
+}
+
+func isDefaultCommand(cmd *parse.CommandNode) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+
+	identifier, ok := cmd.Args[0].(*parse.IdentifierNode)
+
+	return ok && identifier.Ident == "default"
+}
+
+func replaceFunc(old string, new string, value interface{}) string {
+	return strings.ReplaceAll(fmt.Sprint(value), old, new)
+}
+
+func defaultFunc(defaultValue interface{}, value interface{}) interface{} {
+	if value == nil || fmt.Sprint(value) == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+func joinFunc(separator string, values ...interface{}) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(value)
+	}
+
+	return strings.Join(parts, separator)
+}
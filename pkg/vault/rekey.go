@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ansible_vault "github.com/sosedoff/ansible-vault-go"
+)
+
+// ErrUnknownVaultID occurs when no password is configured for vault id
+var ErrUnknownVaultID = errors.New("unknown vault id")
+
+// Password returns configured password of vault id, default one if empty
+func (a App) Password(vaultID string) (Password, error) {
+	if len(vaultID) == 0 {
+		vaultID = DefaultVaultID
+	}
+
+	for _, password := range a.passwords {
+		if password.ID == vaultID {
+			return password, nil
+		}
+	}
+
+	return Password{}, fmt.Errorf("%w: %s", ErrUnknownVaultID, vaultID)
+}
+
+// encrypt encrypts content with password, in 1.2 format with vault id if not the default one
+func encrypt(content string, password Password) (string, error) {
+	encrypted, err := ansible_vault.Encrypt(content, password.Value)
+	if err != nil {
+		return "", err
+	}
+
+	if len(password.ID) == 0 || password.ID == DefaultVaultID {
+		return encrypted, nil
+	}
+
+	return strings.Replace(encrypted, vaultHeader, vaultPrefix+";1.2;"+vaultCipher+";"+password.ID, 1), nil
+}
+
+// Rekey re-encrypts vault files matching glob pattern from old password to new password,
+// files already encrypted with new password are left untouched. It returns changed files, relative to root folder.
+func (a App) Rekey(pattern string, oldPassword Password, newPassword Password) ([]string, error) {
+	if _, ok := a.source.(localFiles); !ok {
+		return nil, ErrReadOnlySource
+	}
+
+	files, err := a.globFiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	oldApp := a
+	oldApp.passwords = []Password{oldPassword}
+
+	newApp := a
+	newApp.passwords = []Password{newPassword}
+
+	var changed []string
+
+	for _, file := range files {
+		fileChanged, err := a.rekeyFile(file, oldApp, newApp, newPassword)
+		if err != nil {
+			return changed, &FileError{File: file, Err: err}
+		}
+
+		if fileChanged {
+			changed = append(changed, a.relativePath(file))
+		}
+	}
+
+	return changed, nil
+}
+
+// rekeyFile re-encrypts file while holding an exclusive lock on it
+func (a App) rekeyFile(file string, oldApp App, newApp App, newPassword Password) (bool, error) {
+	unlockFile, err := a.lockFile(file, true)
+	if err != nil {
+		return false, err
+	}
+
+	defer unlockFile()
+
+	encrypted, err := readFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := oldApp.decrypt(encrypted)
+	if errors.Is(err, ErrWrongPassword) {
+		if _, newErr := newApp.decrypt(encrypted); newErr == nil {
+			return false, nil
+		}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	rekeyed, err := encrypt(content, newPassword)
+	if err != nil {
+		return false, err
+	}
+
+	if err := a.writeFile(file, []byte(rekeyed+"\n")); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,273 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ansibleConfig is the ansible configuration file read in root folder
+	ansibleConfig = "ansible.cfg"
+
+	// rolesFolder and collectionsFolder are searched in root folder before paths of ansible configuration
+	rolesFolder       = "roles"
+	collectionsFolder = "collections"
+)
+
+// ErrRoleNotFound occurs when role is not found in roles paths
+var ErrRoleNotFound = errors.New("role not found")
+
+// roleVarsFolders lists folders of role variables, by precedence
+var roleVarsFolders = []string{"vars", "defaults"}
+
+// roleMainFiles lists names of role variables main file, as ansible tries them
+var roleMainFiles = []string{"main.yml", "main.yaml", "main.json", "main"}
+
+// InRole retrieves given key in variables of role, `vars` taking precedence over `defaults`.
+// Role is a name searched in roles paths or a fully qualified collection name (e.g. `namespace.collection.role`)
+// searched in collections paths. It returns the value and its file, relative to root folder when inside of it.
+func (a App) InRole(role string, key string) (string, string, error) {
+	roleFolder, err := a.findRole(role)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, varsFolder := range roleVarsFolders {
+		files, err := a.roleVarFiles(path.Join(roleFolder, varsFolder))
+		if err != nil {
+			return "", "", err
+		}
+
+		for _, file := range files {
+			value, err := a.getRoleVarKey(file, key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			} else if err != nil {
+				return "", "", err
+			}
+
+			if a.templates && isTemplated(value) {
+				vars, err := a.roleVars(roleFolder)
+				if err != nil {
+					return "", "", err
+				}
+
+				if value, err = a.renderTemplate(file, key, value, vars); err != nil {
+					return "", "", err
+				}
+			}
+
+			return value, a.relativePath(file), nil
+		}
+	}
+
+	return "", "", &KeyNotFoundError{File: "role " + role, Key: key}
+}
+
+// findRole returns folder of role, searched in order in roles or collections paths
+func (a App) findRole(role string) (string, error) {
+	if len(role) == 0 || strings.Contains(role, "/") || strings.Contains(role, "..") || role == "." {
+		return "", fmt.Errorf("%w: invalid role name %s", ErrRoleNotFound, role)
+	}
+
+	searchPaths := a.rolesPaths()
+	roleFolder := role
+
+	if parts := strings.Split(role, "."); len(parts) == 3 {
+		searchPaths = a.collectionsPaths()
+		roleFolder = path.Join("ansible_collections", parts[0], parts[1], "roles", parts[2])
+	}
+
+	for _, searchPath := range searchPaths {
+		fullPath, err := a.resolveSearchPath(searchPath, roleFolder)
+		if errors.As(err, new(*OutsideRootError)) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if info, err := a.source.Stat(fullPath); err == nil && info.IsDir() {
+			return fullPath, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s in %s", ErrRoleNotFound, role, strings.Join(searchPaths, ", "))
+}
+
+// rolesPaths returns roles paths of ansible configuration, after roles folder
+func (a App) rolesPaths() []string {
+	return a.configPaths(rolesFolder, []string{"ANSIBLE_ROLES_PATH"}, []string{"roles_path"})
+}
+
+// collectionsPaths returns collections paths of ansible configuration, after collections folder
+func (a App) collectionsPaths() []string {
+	return a.configPaths(collectionsFolder, []string{"ANSIBLE_COLLECTIONS_PATH", "ANSIBLE_COLLECTIONS_PATHS"}, []string{"collections_path", "collections_paths"})
+}
+
+// configPaths reads a colon separated list of paths from environment or from `[defaults]` section of ansible configuration
+func (a App) configPaths(folder string, envNames []string, configKeys []string) []string {
+	paths := []string{folder}
+
+	for _, envName := range envNames {
+		if value := os.Getenv(envName); len(value) != 0 {
+			return append(paths, splitPathList(value)...)
+		}
+	}
+
+	configFile, err := a.resolvePath(ansibleConfig)
+	if err != nil {
+		return paths
+	}
+
+	content, err := readSourceFile(a.source, configFile)
+	if err != nil {
+		return paths
+	}
+
+	section := parseINISection(content, "defaults")
+
+	for _, configKey := range configKeys {
+		if value := section[configKey]; len(value) != 0 {
+			return append(paths, splitPathList(value)...)
+		}
+	}
+
+	return paths
+}
+
+func splitPathList(value string) []string {
+	var paths []string
+
+	for _, item := range strings.Split(value, ":") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			paths = append(paths, item)
+		}
+	}
+
+	return paths
+}
+
+// resolveSearchPath joins name to a search path, relative to root folder if not absolute
+func (a App) resolveSearchPath(searchPath string, name string) (string, error) {
+	if _, ok := a.source.(localPaths); ok && filepath.IsAbs(searchPath) {
+		fullPath := path.Join(searchPath, name)
+
+		return fullPath, a.checkInRoot(fullPath)
+	}
+
+	if filepath.IsAbs(searchPath) {
+		return "", &OutsideRootError{Path: searchPath, Root: a.rootFolder}
+	}
+
+	return a.resolvePath(path.Join(searchPath, name))
+}
+
+// roleVarFiles returns variables files of a role folder, by precedence. Files of a `main` directory are loaded
+// by ansible in lexical order, the last one overriding the others.
+func (a App) roleVarFiles(folder string) ([]string, error) {
+	for _, name := range roleMainFiles {
+		filename := path.Join(folder, name)
+
+		info, err := a.source.Stat(filename)
+		if err != nil {
+			continue
+		}
+
+		if !info.IsDir() {
+			return []string{filename}, a.checkInRoot(filename)
+		}
+
+		matches, err := a.source.List(path.Join(filename, "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		var files []string
+		for _, match := range matches {
+			if err := a.checkInRoot(match); err != nil {
+				return nil, err
+			}
+
+			if info, err := a.source.Stat(match); err == nil && info.Mode().IsRegular() {
+				files = append(files, match)
+			}
+		}
+
+		sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+		return files, nil
+	}
+
+	return nil, nil
+}
+
+// roleVars merges variables of role, as ansible does: `vars` override `defaults`, last file of a `main` directory
+// overrides the others
+func (a App) roleVars(roleFolder string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+
+	for i := len(roleVarsFolders) - 1; i >= 0; i-- {
+		files, err := a.roleVarFiles(path.Join(roleFolder, roleVarsFolders[i]))
+		if err != nil {
+			return nil, err
+		}
+
+		for j := len(files) - 1; j >= 0; j-- {
+			content, err := a.readRoleVarFile(files[j])
+			if err != nil {
+				return nil, err
+			}
+
+			for name, value := range yamlVars(content, a.document) {
+				vars[name] = value
+			}
+		}
+	}
+
+	return vars, nil
+}
+
+// readRoleVarFile reads a role variables file, decrypted if it is vault encrypted
+func (a App) readRoleVarFile(filename string) (string, error) {
+	content, err := a.readVaultFile(filename)
+	if err != nil {
+		return "", &FileError{File: filename, Err: err}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(content), vaultPrefix) {
+		if content, err = a.decrypt(content); err != nil {
+			return "", &FileError{File: filename, Err: err}
+		}
+	}
+
+	return content, nil
+}
+
+// getRoleVarKey retrieves key in a role variables file, either vault encrypted or plain yaml with inline vault values
+func (a App) getRoleVarKey(filename string, key string) (string, error) {
+	content, err := a.readRoleVarFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := getYAMLKey(filename, content, key, a.document)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(value, vaultPrefix) {
+		return value, nil
+	}
+
+	decrypted, err := a.decrypt(value)
+	if err != nil {
+		return "", &FileError{File: filename, Err: fmt.Errorf("key `%s`: %w", key, err)}
+	}
+
+	return strings.Trim(decrypted, "\n"), nil
+}
@@ -0,0 +1,206 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// s3DefaultRegion is the region used with a custom endpoint when none is configured, as MinIO
+const s3DefaultRegion = "us-east-1"
+
+// S3Source reads vault files from objects of an S3 compatible bucket, under prefix.
+// A custom endpoint is addressed in path style, e.g. MinIO.
+type S3Source struct {
+	AWSConfig
+	Bucket string
+	Prefix string
+
+	client *s3.Client
+}
+
+// connect returns a copy of source with its client created from AWS configuration
+func (s S3Source) connect(ctx context.Context) (S3Source, error) {
+	cfg, err := s.load(ctx)
+	if err != nil {
+		return s, fmt.Errorf("aws s3: %w", err)
+	}
+
+	if len(cfg.Region) == 0 {
+		cfg.Region = s3DefaultRegion
+	}
+
+	s.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// objects are written by other tools, often without checksum
+		o.DisableLogOutputChecksumValidationSkipped = true
+
+		if endpoint := s.baseEndpoint(); endpoint != nil {
+			o.BaseEndpoint = endpoint
+			o.UsePathStyle = true
+		}
+	})
+
+	return s, nil
+}
+
+// s3Client returns client of source, created if source was not connected
+func (s S3Source) s3Client(ctx context.Context) (*s3.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	connected, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return connected.client, nil
+}
+
+// Open reads object
+func (s S3Source) Open(name string) (io.ReadCloser, error) {
+	ctx := context.Background()
+
+	client, err := s.s3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.key(name))})
+	if err != nil {
+		return nil, s3Error(err, "open", name)
+	}
+
+	return output.Body, nil
+}
+
+// Stat describes object, or common prefix as a directory
+func (s S3Source) Stat(name string) (fs.FileInfo, error) {
+	ctx := context.Background()
+
+	client, err := s.s3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.key(name))})
+	if err == nil {
+		var modTime time.Time
+		if output.LastModified != nil {
+			modTime = *output.LastModified
+		}
+
+		return sourceFileInfo{name: name, size: aws.ToInt64(output.ContentLength), modTime: modTime}, nil
+	}
+
+	if err = s3Error(err, "stat", name); !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Bucket),
+		Prefix:    aws.String(s.key(name) + "/"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(1),
+	})
+	if err != nil {
+		return nil, s3Error(err, "list", name)
+	}
+
+	if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return sourceFileInfo{name: name, dir: true}, nil
+}
+
+// List returns objects matching glob pattern
+func (s S3Source) List(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	client, err := s.s3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// objects are listed from the static directory of pattern
+	static := pattern
+	if index := strings.IndexAny(pattern, "*?[\\"); index != -1 {
+		static = pattern[:index]
+	}
+
+	listPrefix := s.key(path.Dir(static + "x"))
+	if listPrefix == s.key(".") {
+		listPrefix = s.Prefix
+	}
+
+	if len(listPrefix) != 0 && !strings.HasSuffix(listPrefix, "/") {
+		listPrefix += "/"
+	}
+
+	var matches []string
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(s.Bucket), Prefix: aws.String(listPrefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err, "list", listPrefix)
+		}
+
+		for _, content := range page.Contents {
+			name := strings.TrimPrefix(strings.TrimPrefix(aws.ToString(content.Key), s.Prefix), "/")
+
+			if matched, _ := path.Match(pattern, name); matched {
+				matches = append(matches, name)
+			}
+		}
+	}
+
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+// key returns object key of source path
+func (s S3Source) key(name string) string {
+	if len(s.Prefix) == 0 {
+		return name
+	}
+
+	if name == "." {
+		return strings.TrimRight(s.Prefix, "/")
+	}
+
+	return strings.TrimRight(s.Prefix, "/") + "/" + name
+}
+
+// s3Error converts a not found response to fs.ErrNotExist, other API errors to their code and message
+func s3Error(err error, op string, name string) error {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("aws s3: %s %s: %w", op, name, err)
+	}
+
+	return fmt.Errorf("aws s3: %s %s: %s: %s", op, name, apiErr.ErrorCode(), apiErr.ErrorMessage())
+}
@@ -0,0 +1,281 @@
+package vault
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrReadOnlySource occurs when writing vault files of a source that can't be written
+var ErrReadOnlySource = errors.New("vault files source is read only")
+
+// Source stores vault files
+type Source interface {
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (fs.FileInfo, error)
+	List(pattern string) ([]string, error)
+}
+
+// localPaths is implemented by sources addressing files with local file system paths, resolved against root folder.
+// Other sources address files with slash separated paths relative to their root, as fs.FS.
+type localPaths interface {
+	localPaths()
+}
+
+// localFiles is implemented by sources whose files are local file system files, that can be locked and rewritten.
+// A git source addresses files with local paths, but reads them from repository objects.
+type localFiles interface {
+	localPaths
+	localFiles()
+}
+
+// WithSource reads vault files from given source, root folder being a path inside of it
+func WithSource(source Source) Option {
+	return func(a *App) {
+		a.source = source
+	}
+}
+
+// LocalSource reads vault files from local file system
+type LocalSource struct{}
+
+func (LocalSource) localPaths() {}
+func (LocalSource) localFiles() {}
+
+// Open opens local file
+func (LocalSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// Stat describes local file
+func (LocalSource) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// List returns local files matching glob pattern
+func (LocalSource) List(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// FSSource reads vault files from a fs.FS
+type FSSource struct {
+	FS fs.FS
+}
+
+// Open opens file of fs
+func (s FSSource) Open(name string) (io.ReadCloser, error) {
+	return s.FS.Open(name)
+}
+
+// Stat describes file of fs
+func (s FSSource) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.FS, name)
+}
+
+// List returns files of fs matching glob pattern
+func (s FSSource) List(pattern string) ([]string, error) {
+	return fs.Glob(s.FS, pattern)
+}
+
+// NewMapSource creates an in memory source of files content by path
+func NewMapSource(files map[string]string) Source {
+	mapFS := make(memoryFS, len(files))
+	for name, content := range files {
+		mapFS[name] = memoryFile{data: []byte(content)}
+	}
+
+	return FSSource{FS: mapFS}
+}
+
+// NewArchiveSource creates a source from a zip, tar or gzipped tar archive, e.g. an ansible bundle artifact
+func NewArchiveSource(filename string) (Source, error) {
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		reader, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		return FSSource{FS: reader}, nil
+	case strings.HasSuffix(filename, ".tar"), strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return readTar(filename)
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", filename)
+	}
+}
+
+// readTar loads regular files of tar archive in memory
+func readTar(filename string) (Source, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var reader io.Reader = file
+
+	if !strings.HasSuffix(filename, ".tar") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		reader = gzipReader
+	}
+
+	mapFS := make(memoryFS)
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		mapFS[path.Clean(strings.TrimPrefix(header.Name, "/"))] = memoryFile{data: data, modTime: header.ModTime}
+	}
+
+	return FSSource{FS: mapFS}, nil
+}
+
+// readSourceFile reads file content from source
+func readSourceFile(source Source, name string) (string, error) {
+	file, err := source.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// sourceFileInfo describes a file of a source without file system
+type sourceFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i sourceFileInfo) Name() string       { return path.Base(i.name) }
+func (i sourceFileInfo) Size() int64        { return i.size }
+func (i sourceFileInfo) ModTime() time.Time { return i.modTime }
+func (i sourceFileInfo) IsDir() bool        { return i.dir }
+func (i sourceFileInfo) Sys() interface{}   { return nil }
+
+func (i sourceFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+// memoryFS is an in memory fs.FS of files content by slash separated path, directories being implied by paths
+type memoryFS map[string]memoryFile
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// openMemoryFile is an opened file or directory of memoryFS, directories can't be read
+type openMemoryFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f openMemoryFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f openMemoryFile) Close() error               { return nil }
+
+// Open opens file or directory
+func (m memoryFS) Open(name string) (fs.File, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return openMemoryFile{Reader: bytes.NewReader(m[name].data), info: info}, nil
+}
+
+// Stat describes file, or directory if a file is under it
+func (m memoryFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if file, ok := m[name]; ok {
+		return sourceFileInfo{name: name, size: int64(len(file.data)), modTime: file.modTime}, nil
+	}
+
+	for filename := range m {
+		if name == "." || strings.HasPrefix(filename, name+"/") {
+			return sourceFileInfo{name: name, dir: true}, nil
+		}
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// Glob returns files and directories matching pattern
+func (m memoryFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	matches := make(map[string]bool)
+
+	for filename := range m {
+		// file and its parent directories
+		for name := filename; name != "."; name = path.Dir(name) {
+			if matched, _ := path.Match(pattern, name); matched {
+				matches[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(matches))
+	for name := range matches {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,737 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	templateStart = "{{"
+	templateEnd   = "}}"
+)
+
+var (
+	// ErrUnsupportedTemplate occurs when a templated value uses a Jinja2 construct that is not supported
+	ErrUnsupportedTemplate = errors.New("unsupported template")
+
+	// ErrUndefinedVariable occurs when a templated value references a variable that is not defined
+	ErrUndefinedVariable = errors.New("undefined variable")
+)
+
+// WithTemplates renders Jinja2 variable references of values found, e.g. `{{ db_user | default('admin') }}`,
+// against variables of the same file. Only variable references and `default`, `lower`, `b64encode` and `to_json`
+// filters are supported.
+func WithTemplates(render bool) Option {
+	return func(a *App) {
+		a.templates = render
+	}
+}
+
+// isTemplated checks if value contains jinja2 delimiters
+func isTemplated(value string) bool {
+	return strings.Contains(value, templateStart) || strings.Contains(value, "{%") || strings.Contains(value, "{#")
+}
+
+// renderTemplate renders templated value of key against given variables
+func (a App) renderTemplate(filename string, key string, value string, vars map[string]interface{}) (string, error) {
+	if !isTemplated(value) {
+		return value, nil
+	}
+
+	scope := newTemplateScope(vars, a.decrypt)
+	scope.rendering[key] = true
+
+	rendered, err := scope.render(value)
+	if err != nil {
+		return "", &FileError{File: filename, Err: fmt.Errorf("key `%s`: %w", key, err)}
+	}
+
+	return rendered, nil
+}
+
+// yamlVars returns top level variables of yaml document, empty if it is not a mapping
+func yamlVars(content string, document int) map[string]interface{} {
+	vars := make(map[string]interface{})
+
+	if node, err := parseYAMLDocument(content, document); err == nil && node != nil {
+		_ = node.Decode(&vars)
+	}
+
+	return vars
+}
+
+// templateScope resolves variables referenced by templated values
+type templateScope struct {
+	vars map[string]interface{}
+
+	// decrypt reveals inline vault values, nil if they are kept as is
+	decrypt func(string) (string, error)
+
+	// rendering holds variables being rendered, for detecting loops
+	rendering map[string]bool
+}
+
+func newTemplateScope(vars map[string]interface{}, decrypt func(string) (string, error)) *templateScope {
+	return &templateScope{
+		vars:      vars,
+		decrypt:   decrypt,
+		rendering: make(map[string]bool),
+	}
+}
+
+// render replaces every `{{ expression }}` of value
+func (s *templateScope) render(value string) (string, error) {
+	for _, unsupported := range []string{"{%", "{#"} {
+		if strings.Contains(value, unsupported) {
+			return "", fmt.Errorf("%w: `%s` blocks are not supported", ErrUnsupportedTemplate, unsupported)
+		}
+	}
+
+	var output strings.Builder
+
+	for {
+		start := strings.Index(value, templateStart)
+		if start == -1 {
+			output.WriteString(value)
+			return output.String(), nil
+		}
+
+		output.WriteString(value[:start])
+
+		end := templateExpressionEnd(value, start+len(templateStart))
+		if end == -1 {
+			return "", fmt.Errorf("%w: unclosed expression `%s`", ErrUnsupportedTemplate, value[start:])
+		}
+
+		expression := value[start+len(templateStart) : end]
+
+		result, err := s.evaluate(expression)
+		if err != nil {
+			return "", err
+		}
+
+		output.WriteString(result)
+		value = value[end+len(templateEnd):]
+	}
+}
+
+// templateExpressionEnd returns index of the end delimiter of expression, ignoring delimiters in string literals
+func templateExpressionEnd(value string, from int) int {
+	var quote byte
+
+	for i := from; i < len(value); i++ {
+		switch {
+		case quote != 0 && value[i] == '\\':
+			i++
+		case quote != 0:
+			if value[i] == quote {
+				quote = 0
+			}
+		case value[i] == '\'' || value[i] == '"':
+			quote = value[i]
+		case strings.HasPrefix(value[i:], templateEnd):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// evaluate renders an expression as a string
+func (s *templateScope) evaluate(expression string) (string, error) {
+	tokens, err := tokenizeTemplate(expression)
+	if err != nil {
+		return "", err
+	}
+
+	parser := templateParser{scope: s, tokens: tokens, source: strings.TrimSpace(expression)}
+
+	result, err := parser.expression()
+	if err != nil {
+		return "", err
+	}
+
+	if !parser.done() {
+		return "", parser.unsupported()
+	}
+
+	if !result.defined {
+		return "", fmt.Errorf("%w: `%s`", ErrUndefinedVariable, result.name)
+	}
+
+	return templateString(result.value)
+}
+
+// variable returns value of a top level variable, rendered if it is templated itself
+func (s *templateScope) variable(name string) (interface{}, bool, error) {
+	value, ok := s.vars[name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	value, err := s.resolve(name, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// resolve decrypts and renders a string value of variable or attribute name, other values are returned as is
+func (s *templateScope) resolve(name string, value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	if s.decrypt != nil && strings.HasPrefix(text, vaultPrefix) {
+		decrypted, err := s.decrypt(text)
+		if err != nil {
+			return nil, fmt.Errorf("variable `%s`: %w", name, err)
+		}
+
+		text = strings.Trim(decrypted, "\n")
+	}
+
+	if !isTemplated(text) {
+		return text, nil
+	}
+
+	if s.rendering[name] {
+		return nil, fmt.Errorf("%w: recursive loop on `%s`", ErrUnsupportedTemplate, name)
+	}
+
+	s.rendering[name] = true
+	defer delete(s.rendering, name)
+
+	return s.render(text)
+}
+
+// resolveAll resolves string values nested in maps and lists of value, as ansible does for a whole variable
+func (s *templateScope) resolveAll(name string, value interface{}) (interface{}, error) {
+	switch content := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(content))
+
+		for key, item := range content {
+			var err error
+			if resolved[key], err = s.resolveAll(name+"."+key, item); err != nil {
+				return nil, err
+			}
+		}
+
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(content))
+
+		for index, item := range content {
+			var err error
+			if resolved[index], err = s.resolveAll(name+"."+strconv.Itoa(index), item); err != nil {
+				return nil, err
+			}
+		}
+
+		return resolved, nil
+	default:
+		return s.resolve(name, value)
+	}
+}
+
+type templateTokenKind int
+
+const (
+	tokenName templateTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type templateToken struct {
+	kind  templateTokenKind
+	value string
+}
+
+func tokenizeTemplate(expression string) ([]templateToken, error) {
+	var tokens []templateToken
+
+	for i := 0; i < len(expression); {
+		char := expression[i]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			i++
+		case char == '_' || isLetter(char):
+			start := i
+			for i < len(expression) && (expression[i] == '_' || isLetter(expression[i]) || isDigit(expression[i])) {
+				i++
+			}
+
+			tokens = append(tokens, templateToken{kind: tokenName, value: expression[start:i]})
+		case isDigit(char):
+			start := i
+			for i < len(expression) && isDigit(expression[i]) {
+				i++
+			}
+
+			tokens = append(tokens, templateToken{kind: tokenNumber, value: expression[start:i]})
+		case char == '\'' || char == '"':
+			var value strings.Builder
+
+			i++
+			for i < len(expression) && expression[i] != char {
+				if expression[i] == '\\' && i+1 < len(expression) {
+					i++
+				}
+
+				value.WriteByte(expression[i])
+				i++
+			}
+
+			if i == len(expression) {
+				return nil, fmt.Errorf("%w: unclosed string in `%s`", ErrUnsupportedTemplate, strings.TrimSpace(expression))
+			}
+
+			i++
+			tokens = append(tokens, templateToken{kind: tokenString, value: value.String()})
+		case strings.IndexByte("|().,[]", char) != -1:
+			tokens = append(tokens, templateToken{kind: tokenSymbol, value: string(char)})
+			i++
+		default:
+			return nil, fmt.Errorf("%w: `%c` in `%s`", ErrUnsupportedTemplate, char, strings.TrimSpace(expression))
+		}
+	}
+
+	return tokens, nil
+}
+
+func isLetter(char byte) bool {
+	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z'
+}
+
+func isDigit(char byte) bool {
+	return '0' <= char && char <= '9'
+}
+
+// templateValue is the result of an expression, undefined values keep the name of the missing variable
+type templateValue struct {
+	value   interface{}
+	defined bool
+	name    string
+}
+
+// templateParser evaluates `operand | filter(args) | ...` expressions
+type templateParser struct {
+	scope    *templateScope
+	tokens   []templateToken
+	position int
+	source   string
+}
+
+func (p *templateParser) done() bool {
+	return p.position >= len(p.tokens)
+}
+
+func (p *templateParser) peek(kind templateTokenKind, value string) bool {
+	return !p.done() && p.tokens[p.position].kind == kind && (len(value) == 0 || p.tokens[p.position].value == value)
+}
+
+func (p *templateParser) next() templateToken {
+	token := p.tokens[p.position]
+	p.position++
+
+	return token
+}
+
+func (p *templateParser) unsupported() error {
+	return fmt.Errorf("%w: `%s`, only variables and default, lower, b64encode and to_json filters are supported", ErrUnsupportedTemplate, p.source)
+}
+
+func (p *templateParser) expression() (templateValue, error) {
+	result, err := p.operand()
+	if err != nil {
+		return result, err
+	}
+
+	for p.peek(tokenSymbol, "|") {
+		p.next()
+
+		if !p.peek(tokenName, "") {
+			return result, p.unsupported()
+		}
+
+		filter := p.next().value
+
+		var args []templateValue
+		if p.peek(tokenSymbol, "(") {
+			if args, err = p.arguments(); err != nil {
+				return result, err
+			}
+		}
+
+		if result, err = applyTemplateFilter(p.scope, filter, result, args); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (p *templateParser) arguments() ([]templateValue, error) {
+	p.next()
+
+	var args []templateValue
+
+	for !p.peek(tokenSymbol, ")") {
+		if len(args) != 0 {
+			if !p.peek(tokenSymbol, ",") {
+				return nil, p.unsupported()
+			}
+
+			p.next()
+		}
+
+		arg, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	p.next()
+
+	return args, nil
+}
+
+func (p *templateParser) operand() (templateValue, error) {
+	if p.done() {
+		return templateValue{}, p.unsupported()
+	}
+
+	token := p.next()
+
+	switch token.kind {
+	case tokenString:
+		return templateValue{value: token.value, defined: true}, nil
+	case tokenNumber:
+		number, err := strconv.Atoi(token.value)
+		if err != nil {
+			return templateValue{}, p.unsupported()
+		}
+
+		return templateValue{value: number, defined: true}, nil
+	case tokenName:
+		switch token.value {
+		case "true", "True":
+			return templateValue{value: true, defined: true}, nil
+		case "false", "False":
+			return templateValue{value: false, defined: true}, nil
+		}
+
+		value, defined, err := p.scope.variable(token.value)
+		if err != nil {
+			return templateValue{}, err
+		}
+
+		return p.attributes(templateValue{value: value, defined: defined, name: token.value})
+	default:
+		return templateValue{}, p.unsupported()
+	}
+}
+
+// attributes resolves `.key`, `['key']` and `[index]` accessors of a variable
+func (p *templateParser) attributes(result templateValue) (templateValue, error) {
+	for p.peek(tokenSymbol, ".") || p.peek(tokenSymbol, "[") {
+		var attribute templateToken
+
+		if p.next().value == "." {
+			if !p.peek(tokenName, "") {
+				return result, p.unsupported()
+			}
+
+			attribute = p.next()
+		} else {
+			if p.done() || p.tokens[p.position].kind == tokenSymbol {
+				return result, p.unsupported()
+			}
+
+			attribute = p.next()
+
+			if !p.peek(tokenSymbol, "]") {
+				return result, p.unsupported()
+			}
+
+			p.next()
+		}
+
+		name := result.name + "." + attribute.value
+		if !result.defined {
+			result.name = name
+			continue
+		}
+
+		value, defined := templateAttribute(result.value, attribute)
+
+		if defined {
+			var err error
+			if value, err = p.scope.resolve(name, value); err != nil {
+				return result, err
+			}
+		}
+
+		result = templateValue{value: value, defined: defined, name: name}
+	}
+
+	return result, nil
+}
+
+func templateAttribute(container interface{}, attribute templateToken) (interface{}, bool) {
+	switch content := container.(type) {
+	case map[string]interface{}:
+		value, ok := content[attribute.value]
+		return value, ok
+	case []interface{}:
+		index, err := strconv.Atoi(attribute.value)
+		if attribute.kind != tokenNumber || err != nil || index >= len(content) {
+			return nil, false
+		}
+
+		return content[index], true
+	default:
+		return nil, false
+	}
+}
+
+func applyTemplateFilter(scope *templateScope, filter string, input templateValue, args []templateValue) (templateValue, error) {
+	switch filter {
+	case "default", "d":
+		if len(args) == 0 || len(args) > 2 {
+			return input, fmt.Errorf("%w: `%s` filter expects a default value and an optional boolean", ErrUnsupportedTemplate, filter)
+		}
+
+		// `default(value, true)` also replaces falsy values, as jinja2
+		falsy := len(args) == 2 && args[1].defined && isTemplateTruthy(args[1].value)
+
+		if !input.defined || (falsy && !isTemplateTruthy(input.value)) {
+			return args[0], nil
+		}
+
+		return input, nil
+	case "lower", "b64encode", "to_json":
+		if len(args) != 0 {
+			return input, fmt.Errorf("%w: `%s` filter has no argument", ErrUnsupportedTemplate, filter)
+		}
+	default:
+		return input, fmt.Errorf("%w: `%s` filter, only default, lower, b64encode and to_json filters are supported", ErrUnsupportedTemplate, filter)
+	}
+
+	if !input.defined {
+		return input, fmt.Errorf("%w: `%s`", ErrUndefinedVariable, input.name)
+	}
+
+	if filter == "to_json" {
+		value, err := scope.resolveAll(input.name, input.value)
+		if err != nil {
+			return input, err
+		}
+
+		content, err := templateJSON(value)
+		if err != nil {
+			return input, err
+		}
+
+		return templateValue{value: content, defined: true, name: input.name}, nil
+	}
+
+	content, err := templateString(input.value)
+	if err != nil {
+		return input, err
+	}
+
+	if filter == "lower" {
+		content = strings.ToLower(content)
+	} else {
+		content = base64.StdEncoding.EncodeToString([]byte(content))
+	}
+
+	return templateValue{value: content, defined: true, name: input.name}, nil
+}
+
+func isTemplateTruthy(value interface{}) bool {
+	switch content := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return content
+	case int:
+		return content != 0
+	case float64:
+		return content != 0
+	case string:
+		return len(content) != 0
+	case map[string]interface{}:
+		return len(content) != 0
+	case []interface{}:
+		return len(content) != 0
+	default:
+		return true
+	}
+}
+
+// templateString renders a scalar as jinja2 does
+func templateString(value interface{}) (string, error) {
+	switch content := value.(type) {
+	case nil:
+		return "None", nil
+	case string:
+		return content, nil
+	case bool:
+		if content {
+			return "True", nil
+		}
+
+		return "False", nil
+	case int:
+		return strconv.Itoa(content), nil
+	case float64:
+		return pythonFloat(content), nil
+	default:
+		return "", fmt.Errorf("%w: %T value can't be rendered as a string, use to_json filter", ErrUnsupportedTemplate, value)
+	}
+}
+
+// pythonFloat formats a float as python `repr`, keeping `.0` of integral values and using exponent from 1e16
+func pythonFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+
+	if exponent := math.Floor(math.Log10(math.Abs(value))); value != 0 && (exponent < -4 || exponent >= 16) {
+		return strconv.FormatFloat(value, 'e', -1, 64)
+	}
+
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+
+	return formatted
+}
+
+// templateJSON encodes value as ansible `to_json` filter, with python separators. Keys are sorted, whereas ansible
+// keeps their order in file, because variables are decoded to maps.
+func templateJSON(value interface{}) (string, error) {
+	var buffer bytes.Buffer
+
+	if err := writeTemplateJSON(&buffer, value); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func writeTemplateJSON(buffer *bytes.Buffer, value interface{}) error {
+	switch content := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(content))
+		for key := range content {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		buffer.WriteByte('{')
+		for i, key := range keys {
+			if i != 0 {
+				buffer.WriteString(", ")
+			}
+
+			if err := writeTemplateJSON(buffer, key); err != nil {
+				return err
+			}
+
+			buffer.WriteString(": ")
+
+			if err := writeTemplateJSON(buffer, content[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+
+		return nil
+	case []interface{}:
+		buffer.WriteByte('[')
+		for i, item := range content {
+			if i != 0 {
+				buffer.WriteString(", ")
+			}
+
+			if err := writeTemplateJSON(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+
+		return nil
+	case float64:
+		if math.IsInf(content, 0) || math.IsNaN(content) {
+			return fmt.Errorf("%w: %s value can't be encoded as json", ErrUnsupportedTemplate, pythonFloat(content))
+		}
+
+		buffer.WriteString(pythonFloat(content))
+
+		return nil
+	case string:
+		return writeTemplateJSONString(buffer, content)
+	default:
+		encoded, err := json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnsupportedTemplate, err)
+		}
+
+		buffer.Write(encoded)
+
+		return nil
+	}
+}
+
+// writeTemplateJSONString encodes a string as python `json.dumps`: `&`, `<` and `>` are kept as is, non ASCII
+// characters are escaped, as UTF-16 surrogate pairs beyond the basic multilingual plane
+func writeTemplateJSONString(buffer *bytes.Buffer, value string) error {
+	var encoded bytes.Buffer
+
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnsupportedTemplate, err)
+	}
+
+	for _, char := range strings.TrimSuffix(encoded.String(), "\n") {
+		switch {
+		case char < utf8.RuneSelf:
+			buffer.WriteRune(char)
+		case char > 0xffff:
+			high, low := utf16.EncodeRune(char)
+			fmt.Fprintf(buffer, "\\u%04x\\u%04x", high, low)
+		default:
+			fmt.Fprintf(buffer, "\\u%04x", char)
+		}
+	}
+
+	return nil
+}
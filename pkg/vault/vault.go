@@ -1,16 +1,19 @@
 package vault
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"html/template"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	ansible_vault "github.com/sosedoff/ansible-vault-go"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -22,31 +25,108 @@ var (
 
 	// ErrKeyNotFound occurs when key is not found in vault
 	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrNoFileMatched occurs when glob pattern doesn't match any file
+	ErrNoFileMatched = errors.New("no file matched")
+
+	// ErrAmbiguousKey occurs when key is defined in several files without merge strategy
+	ErrAmbiguousKey = errors.New("key defined in several files")
+
+	// ErrUnknownMergeStrategy occurs when merge strategy is not supported
+	ErrUnknownMergeStrategy = errors.New("unknown merge strategy")
 )
 
+const (
+	// MergeError fails when key is defined in several files
+	MergeError = "error"
+
+	// MergeFirst keeps value of the first file, in lexical order, defining the key
+	MergeFirst = "first"
+
+	// MergeLast keeps value of the last file, in lexical order, defining the key (Ansible behavior)
+	MergeLast = "last"
+)
+
+// MergeStrategies lists supported merge strategies
+var MergeStrategies = []string{MergeError, MergeFirst, MergeLast}
+
 // App of package
 type App struct {
-	vaultPassword string
-	rootFolder    string
-	path_template template.Template
+	passwords        []Password
+	rootFolder       string
+	allowOutsideRoot bool
+	pathPatterns     map[string]pathPattern
+	backup           bool
+	lockTimeout      time.Duration
+	source           Source
+	templates        bool
+	document         int
+	format           string
 }
 
-// New creates new App from Config
-func New(vaultPassword string, rootFolder string, path_pattern string) (*App, error) {
+// Option configures optional behavior of App
+type Option func(*App)
+
+// WithPasswords adds passwords tried after vault password
+func WithPasswords(passwords ...Password) Option {
+	return func(a *App) {
+		a.passwords = append(a.passwords, passwords...)
+	}
+}
+
+// WithBackup keeps a `.bak` copy of vault files before overwriting them
+func WithBackup(backup bool) Option {
+	return func(a *App) {
+		a.backup = backup
+	}
+}
+
+// New creates new App from Config. Root folder is used as is, local paths being expanded by caller, e.g. with
+// ExpandPath: it is a path inside of archive or bucket sources.
+func New(vaultPassword string, rootFolder string, pathPatterns map[string]string, options ...Option) (*App, error) {
 	if rootFolder == "" {
 		return nil, ErrNoRootFolder
 	}
 
-	return &App{
-		vaultPassword: vaultPassword,
-		rootFolder:    rootFolder,
-		path_template: *template.Must(
-			template.New("path_pattern").Parse(path_pattern),
-		),
-	}, nil
+	patterns, err := parsePathPatterns(pathPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{
+		rootFolder:   rootFolder,
+		pathPatterns: patterns,
+		lockTimeout:  DefaultLockTimeout,
+		source:       LocalSource{},
+	}
+
+	if len(vaultPassword) != 0 {
+		app.passwords = []Password{{ID: DefaultVaultID, Value: vaultPassword}}
+	}
+
+	for _, option := range options {
+		option(app)
+	}
+
+	if git, ok := app.source.(*gitSource); ok {
+		if err := git.resolve(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s3Source, ok := app.source.(S3Source); ok {
+		connected, err := s3Source.connect(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		app.source = connected
+	}
+
+	return app, nil
 }
 
-// GetVaultPassword is a helper for retrieve vault password value
+// GetVaultPassword is a helper for retrieve vault password value, vault path being already expanded
 func GetVaultPassword(vaultPath string, vaultPass string) (string, error) {
 	if vaultPath == "" && vaultPass == "" {
 		return "", ErrNoVaultPass
@@ -73,61 +153,341 @@ func getVaultValueAtPath(vaultPath string) (string, error) {
 	return strings.TrimRight(string(data), "\n"), nil
 }
 
-func (a App) getVaultKey(filename string, key string, getVaultContent func(string, string) (string, error)) (string, error) {
-	rawVault, err := getVaultContent(filename, a.vaultPassword)
+func readFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (a App) getVaultKey(filename string, key string, getVaultContent func(string) (string, error)) (string, error) {
+	encrypted, err := getVaultContent(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", &FileNotFoundError{File: filename, Err: err}
+		}
+
+		return "", &FileError{File: filename, Err: err}
+	}
+
+	rawVault, err := a.decrypt(encrypted)
+	if err != nil {
+		return "", &FileError{File: filename, Err: err}
+	}
+
+	format, err := a.fileFormat(filename)
 	if err != nil {
 		return "", err
 	}
 
+	value, err := getPayloadKey(filename, rawVault, key, format, a.document)
+	if err != nil || !a.templates || len(strings.TrimSpace(key)) == 0 {
+		return value, err
+	}
+
+	return a.renderTemplate(filename, key, value, payloadVars(rawVault, format, a.document))
+}
+
+// getYAMLKey returns value at dotted key path of yaml document, whole content if key is empty
+func getYAMLKey(filename string, rawVault string, key string, document int) (string, error) {
 	// trim of carriage return for easier use
-	if len(strings.TrimSpace(key)) == 0 {
+	if len(strings.TrimSpace(key)) == 0 && document == 0 {
 		return strings.Trim(rawVault, "\n"), nil
 	}
 
-	var vaultContent = make(map[interface{}]interface{})
-	if err := yaml.Unmarshal([]byte(rawVault), &vaultContent); err != nil {
-		return "", err
+	node, err := parseYAMLDocument(rawVault, document)
+	if err != nil {
+		return "", &FileError{File: filename, Err: err}
+	}
+
+	if len(strings.TrimSpace(key)) == 0 {
+		if node == nil {
+			return "", nil
+		}
+
+		content, err := yaml.Marshal(node)
+		if err != nil {
+			return "", &FileError{File: filename, Err: err}
+		}
+
+		return strings.Trim(string(content), "\n"), nil
+	}
+
+	if node == nil || (node.Kind == yaml.ScalarNode && node.ShortTag() == yamlNullTag) {
+		return "", &KeyNotFoundError{File: filename, Key: key}
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return "", &FileError{File: filename, Err: &YAMLError{Line: node.Line, Column: node.Column, Message: fmt.Sprintf("document is a %s, not a mapping", node.ShortTag())}}
 	}
 
 	keys := strings.Split(key, ".")
-	for _, k := range keys {
-		switch v := vaultContent[k].(type) {
-		case map[interface{}]interface{}:
-			vaultContent = v
-		case string:
-			return strings.Trim(v, "\n"), nil
-		case int:
-			return strconv.Itoa(v), nil
-		case bool:
-			return strconv.FormatBool(v), nil
+	for i, k := range keys {
+		last := i == len(keys)-1
+
+		value, err := yamlMappingValue(node, k)
+		if err != nil {
+			return "", &FileError{File: filename, Err: err}
+		}
+
+		if value != nil && !last && value.Kind == yaml.MappingNode {
+			node = value
+			continue
 		}
+
+		if value != nil && last {
+			if scalar, ok := yamlScalar(value); ok {
+				return strings.Trim(scalar, "\n"), nil
+			}
+		}
+
+		return "", &KeyNotFoundError{File: filename, Key: key, Segment: k}
 	}
 
-	return "", ErrKeyNotFound
+	return "", &KeyNotFoundError{File: filename, Key: key}
 }
 
-// InPathPattern retrieves given key in environment vault
-func (a App) InPathPattern(pathParams map[string]interface{}, key string) (string, error) {
-	var buffer bytes.Buffer
-	err := a.path_template.Execute(&buffer, pathParams)
+func (a App) getPathPattern(patternName string) (pathPattern, error) {
+	if len(patternName) == 0 {
+		patternName = DefaultPathPattern
+	}
+
+	pattern, ok := a.pathPatterns[patternName]
+	if !ok {
+		return pathPattern{}, fmt.Errorf("%w: %s", ErrUnknownPathPattern, patternName)
+	}
+
+	return pattern, nil
+}
+
+// RenderPathPattern renders the named path pattern, default one if empty, with given path params
+func (a App) RenderPathPattern(patternName string, pathParams map[string]interface{}) (string, error) {
+	pattern, err := a.getPathPattern(patternName)
+	if err != nil {
+		return "", err
+	}
+
+	return pattern.render(pathParams)
+}
+
+// InPathPattern retrieves given key in vault file of the named path pattern, default one if empty
+func (a App) InPathPattern(patternName string, pathParams map[string]interface{}, key string) (string, error) {
+	renderedPath, err := a.RenderPathPattern(patternName, pathParams)
+	if err != nil {
+		return "", err
+	}
+
+	vaultPath, err := a.resolvePath(renderedPath)
 	if err != nil {
 		return "", err
 	}
 
-	return a.getVaultKey(path.Join(a.rootFolder, buffer.String()), key, ansible_vault.DecryptFile)
+	return a.getVaultKey(vaultPath, key, a.readVaultFile)
+}
+
+// InPathPatterns retrieves given key in the first vault file of the named path pattern defining it, rendered with each path params in order
+func (a App) InPathPatterns(patternName string, pathParamsList []map[string]interface{}, key string) (string, string, error) {
+	pattern, err := a.getPathPattern(patternName)
+	if err != nil {
+		return "", "", err
+	}
+
+	vaultPaths := make([]string, len(pathParamsList))
+	for i, pathParams := range pathParamsList {
+		renderedPath, err := pattern.render(pathParams)
+		if err != nil {
+			return "", "", err
+		}
+
+		vaultPaths[i] = renderedPath
+	}
+
+	return a.InPaths(vaultPaths, key)
+}
+
+// InPaths retrieves given key in the first vault file defining it, missing files are skipped
+func (a App) InPaths(vaultPaths []string, key string) (string, string, error) {
+	for _, vaultPath := range vaultPaths {
+		fullPath, err := a.resolvePath(vaultPath)
+		if err != nil {
+			return "", "", err
+		}
+
+		value, err := a.getVaultKey(fullPath, key, a.readVaultFile)
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", "", err
+		}
+
+		return value, vaultPath, nil
+	}
+
+	return "", "", &KeyNotFoundError{File: strings.Join(vaultPaths, ", "), Key: key}
 }
 
 // InPath retrieves given key in vault file
 func (a App) InPath(vaultPath string, key string) (string, error) {
-	return a.getVaultKey(path.Join(a.rootFolder, vaultPath), key, ansible_vault.DecryptFile)
+	fullPath, err := a.resolvePath(vaultPath)
+	if err != nil {
+		return "", err
+	}
+
+	return a.getVaultKey(fullPath, key, a.readVaultFile)
 }
 
 // InString retrieves given key in vault file
 func (a App) InString(rawVault string, key string) (string, error) {
-	return a.getVaultKey(rawVault, key, ansible_vault.Decrypt)
+	return a.getVaultKey(inlineVault, key, func(string) (string, error) {
+		return rawVault, nil
+	})
 }
 
 // InString encrypts a string
 func (a App) InEncString(rawValue string) (string, error) {
-	return ansible_vault.Encrypt(rawValue, a.vaultPassword)
+	if len(a.passwords) == 0 {
+		return "", ErrNoVaultPass
+	}
+
+	return ansible_vault.Encrypt(rawValue, a.passwords[0].Value)
+}
+
+// InGlob retrieves given key in files matching glob pattern, or in files of the directory
+func (a App) InGlob(pattern string, key string, mergeStrategy string) (string, string, error) {
+	if mergeStrategy == "" {
+		mergeStrategy = MergeError
+	}
+
+	if mergeStrategy != MergeError && mergeStrategy != MergeFirst && mergeStrategy != MergeLast {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownMergeStrategy, mergeStrategy)
+	}
+
+	files, err := a.globFiles(pattern)
+	if err != nil {
+		return "", "", err
+	}
+
+	var value, source string
+
+	for _, file := range files {
+		fileValue, err := a.getVaultKey(file, key, a.readVaultFile)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return "", "", err
+		}
+
+		if len(source) != 0 {
+			if mergeStrategy == MergeError {
+				return "", "", fmt.Errorf("%w: %s and %s", ErrAmbiguousKey, a.relativePath(source), a.relativePath(file))
+			}
+
+			if mergeStrategy == MergeFirst {
+				continue
+			}
+		}
+
+		value = fileValue
+		source = file
+	}
+
+	if len(source) == 0 {
+		return "", "", &KeyNotFoundError{File: pattern, Key: key}
+	}
+
+	return value, a.relativePath(source), nil
+}
+
+func (a App) globFiles(pattern string) ([]string, error) {
+	fullPattern, err := a.resolvePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	directory := false
+	if info, err := a.source.Stat(fullPattern); err == nil && info.IsDir() {
+		fullPattern = path.Join(fullPattern, "*")
+		directory = true
+	}
+
+	matches, err := a.source.List(fullPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, match := range matches {
+		if directory && !isVarsFile(match) || strings.HasSuffix(match, backupSuffix) {
+			continue
+		}
+
+		if err := a.checkInRoot(match); err != nil {
+			return nil, err
+		}
+
+		info, err := a.source.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		// other files of a directory, e.g. plain variables, are not vault files
+		isVault, err := a.isVaultFile(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if isVault {
+			files = append(files, match)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoFileMatched, pattern)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// isVarsFile checks that file of a directory is loaded by ansible: not hidden, with a yaml, json or no extension
+func isVarsFile(filename string) bool {
+	name := path.Base(filename)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	switch path.Ext(name) {
+	case "", ".yml", ".yaml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// isVaultFile checks that file starts with ansible vault header
+func (a App) isVaultFile(filename string) (bool, error) {
+	file, err := a.source.Open(filename)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header := make([]byte, 64)
+
+	read, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return strings.HasPrefix(strings.TrimLeft(string(header[:read]), " \t\r\n"), vaultPrefix), nil
 }
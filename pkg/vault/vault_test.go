@@ -1,12 +1,30 @@
 package vault
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	ansible_vault "github.com/sosedoff/ansible-vault-go"
 )
 
@@ -16,24 +34,58 @@ const (
 
 func TestNew(t *testing.T) {
 	var cases = []struct {
-		intention  string
-		vaultPass  string
-		rootFolder string
-		want       *App
-		wantErr    error
+		intention   string
+		vaultPass   string
+		rootFolder  string
+		pathPattern string
+		want        *App
+		wantErr     error
 	}{
 		{
 			"should reject empty root folder",
 			"~/.vault_pass.txt",
 			"",
+			"",
 			nil,
 			ErrNoRootFolder,
 		},
+		{
+			"should reject unparsable path pattern",
+			"secret",
+			ansibleFolder,
+			"group_vars/{{ .env }/vault.yml",
+			nil,
+			errors.New("invalid path pattern: template: path_pattern:1: unexpected \"}\" in operand"),
+		},
+		{
+			"should reject nested reference in path pattern",
+			"secret",
+			ansibleFolder,
+			"group_vars/{{ .env.name }}/vault.yml",
+			nil,
+			errors.New("invalid path pattern: `.env.name` is not a path parameter"),
+		},
+		{
+			"should reject dot reference in path pattern",
+			"secret",
+			ansibleFolder,
+			"group_vars/{{ . }}/vault.yml",
+			nil,
+			errors.New("invalid path pattern: `.` is not a path parameter"),
+		},
+		{
+			"should reject range in path pattern",
+			"secret",
+			ansibleFolder,
+			"group_vars/{{ range .envs }}{{ . }}{{ end }}/vault.yml",
+			nil,
+			errors.New("invalid path pattern: `{{range .envs}}{{.}}{{end}}` is not a path parameter"),
+		},
 	}
 
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
-			result, err := New(testCase.vaultPass, testCase.rootFolder, "")
+			result, err := New(testCase.vaultPass, testCase.rootFolder, map[string]string{DefaultPathPattern: testCase.pathPattern})
 
 			failed := false
 
@@ -101,7 +153,7 @@ func TestGetVaultKey(t *testing.T) {
 		rootFolder      string
 		input           string
 		key             string
-		getVaultContent func(string, string) (string, error)
+		getVaultContent func(string) (string, error)
 		want            string
 		wantErr         error
 	}{
@@ -111,7 +163,7 @@ func TestGetVaultKey(t *testing.T) {
 			"ansible",
 			"notExistingFile.txt",
 			"api_key",
-			ansible_vault.DecryptFile,
+			readFile,
 			"",
 			errors.New("open notExistingFile.txt: no such file or directory"),
 		},
@@ -121,9 +173,9 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "simple_vault_test.yaml"),
 			"api_key",
-			ansible_vault.DecryptFile,
+			readFile,
 			"",
-			ErrKeyNotFound,
+			fmt.Errorf("key `api_key` not found in %s", path.Join(ansibleFolder, "simple_vault_test.yaml")),
 		},
 		{
 			"should handle empty key",
@@ -131,7 +183,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "simple_vault_test.yaml"),
 			"",
-			ansible_vault.DecryptFile,
+			readFile,
 			"API_KEY: NOT_IN_CLEAR_TEXT",
 			nil,
 		},
@@ -141,9 +193,9 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "invalid_yaml_test.yaml"),
 			"api_key",
-			ansible_vault.DecryptFile,
+			readFile,
 			"",
-			errors.New("yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `I'm not...` into map[interface {}]interface {}"),
+			fmt.Errorf("%s: invalid yaml: line 3, column 1: document is a !!str, not a mapping", path.Join(ansibleFolder, "invalid_yaml_test.yaml")),
 		},
 		{
 			"should handle multi-line vault file",
@@ -151,7 +203,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "complex_vault_test.yaml"),
 			"API_secret",
-			ansible_vault.DecryptFile,
+			readFile,
 			"password",
 			nil,
 		},
@@ -161,7 +213,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "complex_vault_test.yaml"),
 			"MULTILINE_token",
-			ansible_vault.DecryptFile,
+			readFile,
 			"foo\nbar",
 			nil,
 		},
@@ -171,9 +223,9 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "complex_vault_test.yaml"),
 			"KEY_NOT_FOUND",
-			ansible_vault.DecryptFile,
+			readFile,
 			"",
-			ErrKeyNotFound,
+			fmt.Errorf("key `KEY_NOT_FOUND` not found in %s", path.Join(ansibleFolder, "complex_vault_test.yaml")),
 		},
 		{
 			"double_quoted string",
@@ -181,7 +233,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"double_quoted",
-			ansible_vault.DecryptFile,
+			readFile,
 			"test",
 			nil,
 		},
@@ -191,7 +243,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"single_quoted",
-			ansible_vault.DecryptFile,
+			readFile,
 			"test",
 			nil,
 		},
@@ -201,7 +253,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"unquoted",
-			ansible_vault.DecryptFile,
+			readFile,
 			"test",
 			nil,
 		},
@@ -211,7 +263,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"single_quote",
-			ansible_vault.DecryptFile,
+			readFile,
 			"'",
 			nil,
 		},
@@ -221,7 +273,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"integer",
-			ansible_vault.DecryptFile,
+			readFile,
 			"11",
 			nil,
 		},
@@ -231,7 +283,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"quote_inside",
-			ansible_vault.DecryptFile,
+			readFile,
 			"abc'def",
 			nil,
 		},
@@ -241,7 +293,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"double_quote_inside",
-			ansible_vault.DecryptFile,
+			readFile,
 			"abc\"def",
 			nil,
 		},
@@ -251,7 +303,7 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"boolean",
-			ansible_vault.DecryptFile,
+			readFile,
 			"true",
 			nil,
 		},
@@ -261,15 +313,45 @@ func TestGetVaultKey(t *testing.T) {
 			"./",
 			path.Join(ansibleFolder, "sanitized_vault.yml"),
 			"nested.variable",
-			ansible_vault.DecryptFile,
+			readFile,
 			"value",
 			nil,
 		},
+		{
+			"missing nested segment",
+			"secret",
+			"./",
+			path.Join(ansibleFolder, "sanitized_vault.yml"),
+			"nested.unknown.variable",
+			readFile,
+			"",
+			fmt.Errorf("key `nested.unknown.variable` not found in %s: no `unknown` in path", path.Join(ansibleFolder, "sanitized_vault.yml")),
+		},
+		{
+			"scalar is not a nested path",
+			"secret",
+			"./",
+			path.Join(ansibleFolder, "sanitized_vault.yml"),
+			"unquoted.variable",
+			readFile,
+			"",
+			fmt.Errorf("key `unquoted.variable` not found in %s: no `unquoted` in path", path.Join(ansibleFolder, "sanitized_vault.yml")),
+		},
+		{
+			"wrong password",
+			"not_secret",
+			"./",
+			path.Join(ansibleFolder, "sanitized_vault.yml"),
+			"unquoted",
+			readFile,
+			"",
+			fmt.Errorf("%s: wrong vault password, tried vault ids: default", path.Join(ansibleFolder, "sanitized_vault.yml")),
+		},
 	}
 
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
-			app, err := New(testCase.vaultPass, testCase.rootFolder, "")
+			app, err := New(testCase.vaultPass, testCase.rootFolder, nil)
 			if err != nil {
 				t.Errorf("unable to create App: %#v", err)
 				return
@@ -357,168 +439,556 @@ func TestGetVaultPassword(t *testing.T) {
 	}
 }
 
-func TestInEnv(t *testing.T) {
+func TestPasswordSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("password scripts are shell scripts")
+	}
+
+	binFolder := t.TempDir()
+
+	scripts := map[string]string{
+		"vault-pass.sh": "#!/bin/sh\necho \"$1_secret\"\n",
+		"fail.sh":       "#!/bin/sh\necho 'no password' >&2\nexit 1\n",
+		"pass": `#!/bin/sh
+if [ "$1" = "show" ] && [ "$2" = "infra/vault" ]; then
+	printf 'store_secret\nlogin: admin\n'
+else
+	echo "Error: $2 is not in the password store." >&2
+	exit 1
+fi
+`,
+	}
+
+	for name, content := range scripts {
+		if err := os.WriteFile(path.Join(binFolder, name), []byte(content), 0700); err != nil {
+			t.Fatalf("unable to write script: %s", err)
+		}
+	}
+
+	t.Setenv("TEST_VAULT_PASS", "env_secret")
+	t.Setenv("TEST_EMPTY_VAULT_PASS", "")
+
 	var cases = []struct {
-		intention  string
-		pattern    string
-		pathParams map[string]interface{}
-		key        string
-		want       string
-		wantErr    error
+		intention string
+		source    PasswordSource
+		want      string
+		wantErr   string
 	}{
 		{
-			"simple",
-			"group_vars/tag_{{.env}}/vault.yml",
-			map[string]interface{}{
-				"env": "prod",
-			},
-			"API_KEY",
-			"PROD_KEEP_IT_SECRET",
-			nil,
+			"env",
+			EnvPasswordSource{Name: "TEST_VAULT_PASS"},
+			"env_secret",
+			"",
 		},
 		{
-			"not existing env",
-			"group_vars/tag_{{.env}}/vault.yml",
-			map[string]interface{}{
-				"env": "dev",
-			},
-			"API_KEY",
+			"unset env",
+			EnvPasswordSource{Name: "TEST_UNSET_VAULT_PASS"},
+			"",
+			"environment variable `TEST_UNSET_VAULT_PASS` is not set",
+		},
+		{
+			"empty env",
+			EnvPasswordSource{Name: "TEST_EMPTY_VAULT_PASS"},
+			"",
+			ErrEmptyPassword.Error(),
+		},
+		{
+			"command",
+			CommandPasswordSource{Command: path.Join(binFolder, "vault-pass.sh"), Args: []string{"prod"}},
+			"prod_secret",
+			"",
+		},
+		{
+			"failing command",
+			CommandPasswordSource{Command: path.Join(binFolder, "fail.sh")},
+			"",
+			path.Join(binFolder, "fail.sh") + ": exit status 1: no password",
+		},
+		{
+			"password store",
+			StorePasswordSource{Store: path.Join(binFolder, "pass"), Entry: "infra/vault"},
+			"store_secret",
 			"",
-			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "group_vars/tag_dev/vault.yml")),
+		},
+		{
+			"unknown password store entry",
+			StorePasswordSource{Store: path.Join(binFolder, "pass"), Entry: "infra/unknown"},
+			"",
+			path.Join(binFolder, "pass") + ": exit status 1: Error: infra/unknown is not in the password store.",
 		},
 	}
 
-	var failed bool
-
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
+			result, err := testCase.source.Password()
 
-			app, err := New("secret", ansibleFolder, testCase.pattern)
-			if err != nil {
-				t.Errorf("unable to create App: %#v", err)
-				return
+			if (err == nil && len(testCase.wantErr) != 0) || (err != nil && err.Error() != testCase.wantErr) {
+				t.Errorf("Password() = %v, want %s", err, testCase.wantErr)
 			}
 
-			result, err := app.InPathPattern(testCase.pathParams, testCase.key)
+			if result != testCase.want {
+				t.Errorf("Password() = `%s`, want `%s`", result, testCase.want)
+			}
+		})
+	}
+}
+
+// fdHelperEnv holds file descriptor read by TestFDPasswordSourceHelper when it runs as a subprocess
+const fdHelperEnv = "TEST_FD_PASSWORD_SOURCE"
 
-			failed = false
+// TestFDPasswordSourceHelper prints password of a file descriptor, when started by TestFDPasswordSource
+func TestFDPasswordSourceHelper(t *testing.T) {
+	fd, ok := os.LookupEnv(fdHelperEnv)
+	if !ok {
+		return
+	}
 
-			if err == nil && testCase.wantErr != nil {
-				failed = true
-			} else if err != nil && testCase.wantErr == nil {
-				failed = true
-			} else if err != nil && err.Error() != testCase.wantErr.Error() {
-				failed = true
-			} else if result != testCase.want {
-				failed = true
-			}
+	number, err := strconv.Atoi(fd)
+	if err != nil {
+		t.Fatalf("invalid file descriptor: %s", err)
+	}
 
-			if failed {
-				t.Errorf("InEnv(`%s`, `%s`) = (`%s`, %#v), want (`%s`, %#v)", testCase.pathParams, testCase.key, result, err, testCase.want, testCase.wantErr)
-			}
-		})
+	password, err := FDPasswordSource{FD: number}.Password()
+	if err != nil {
+		fmt.Print(err)
+		os.Exit(1)
 	}
+
+	fmt.Print(password)
+	os.Exit(0)
 }
 
-func TestInPath(t *testing.T) {
+func TestFDPasswordSource(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptors are read through /proc")
+	}
+
+	passwordFile, err := os.CreateTemp(t.TempDir(), "vault_pass")
+	if err != nil {
+		t.Fatalf("unable to create password file: %s", err)
+	}
+
+	defer func() {
+		_ = passwordFile.Close()
+	}()
+
+	if _, err := passwordFile.WriteString("fd_secret\n"); err != nil {
+		t.Fatalf("unable to write password file: %s", err)
+	}
+
 	var cases = []struct {
 		intention string
-		path      string
-		key       string
+		fd        uintptr
+		extra     bool
+		env       []string
 		want      string
-		wantErr   error
 	}{
 		{
-			"simple",
-			"tag_prod/vault.yml",
-			"API_KEY",
-			"PROD_KEEP_IT_SECRET",
+			"inherited file descriptor",
+			3,
+			true,
 			nil,
+			"fd_secret",
 		},
 		{
-			"not existing env",
-			"not_found.yml",
-			"API_KEY",
-			"",
-			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "group_vars", "not_found.yml")),
+			"file descriptor of terraform process",
+			passwordFile.Fd(),
+			false,
+			[]string{terraformPluginCookie + "=cookie"},
+			"fd_secret",
+		},
+		{
+			"closed file descriptor",
+			42,
+			false,
+			nil,
+			"unable to read file descriptor 42: open /dev/fd/42: no such file or directory",
 		},
 	}
 
-	var failed bool
-
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestFDPasswordSourceHelper$")
+			cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", fdHelperEnv, testCase.fd))
+			cmd.Env = append(cmd.Env, testCase.env...)
 
-			app, err := New("secret", path.Join(ansibleFolder, "group_vars"), "")
-			if err != nil {
-				t.Errorf("unable to create App: %#v", err)
+			if testCase.extra {
+				cmd.ExtraFiles = []*os.File{passwordFile}
+			}
+
+			output, _ := cmd.Output()
+
+			if result := string(output); result != testCase.want {
+				t.Errorf("FDPasswordSource{%d}.Password() = `%s`, want `%s`", testCase.fd, result, testCase.want)
+			}
+		})
+	}
+}
+
+func TestHashicorpVaultPasswordSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+			var payload map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload["role_id"] != "ansible" || payload["secret_id"] != "approle_secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
 				return
 			}
 
-			result, err := app.InPath(testCase.path, testCase.key)
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"approle_token"}}`))
+			return
+		}
 
-			failed = false
+		if token := r.Header.Get("X-Vault-Token"); token != "root" && token != "approle_token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
 
-			if err == nil && testCase.wantErr != nil {
-				failed = true
-			} else if err != nil && testCase.wantErr == nil {
-				failed = true
-			} else if err != nil && err.Error() != testCase.wantErr.Error() {
-				failed = true
-			} else if result != testCase.want {
-				failed = true
+		switch r.URL.Path {
+		case "/v1/secret/data/ansible":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"kv2_secret"},"metadata":{"version":3}}}`))
+		case "/v1/kv/ansible":
+			_, _ = w.Write([]byte(`{"data":{"password":"kv1_secret","vault_pass":"kv1_field_secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	var cases = []struct {
+		intention string
+		source    HashicorpVaultPasswordSource
+		want      string
+		wantErr   string
+	}{
+		{
+			"kv v2",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "secret/data/ansible", Token: "root"},
+			"kv2_secret",
+			"",
+		},
+		{
+			"kv v1 with field",
+			HashicorpVaultPasswordSource{Address: server.URL + "/", Path: "/kv/ansible", Field: "vault_pass", Token: "root"},
+			"kv1_field_secret",
+			"",
+		},
+		{
+			"approle",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "kv/ansible", RoleID: "ansible", SecretID: "approle_secret"},
+			"kv1_secret",
+			"",
+		},
+		{
+			"invalid approle",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "kv/ansible", RoleID: "ansible", SecretID: "wrong"},
+			"",
+			"hashicorp vault: auth/approle/login: 400 Bad Request: invalid role or secret ID",
+		},
+		{
+			"no credentials",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "kv/ansible"},
+			"",
+			"hashicorp vault: token or approle role id is required",
+		},
+		{
+			"invalid token",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "kv/ansible", Token: "wrong"},
+			"",
+			"hashicorp vault: kv/ansible: 403 Forbidden: permission denied",
+		},
+		{
+			"unknown secret",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "kv/unknown", Token: "root"},
+			"",
+			"hashicorp vault: kv/unknown: 404 Not Found",
+		},
+		{
+			"unknown field",
+			HashicorpVaultPasswordSource{Address: server.URL, Path: "secret/data/ansible", Field: "vault_pass", Token: "root"},
+			"",
+			"hashicorp vault: no `vault_pass` field in secret/data/ansible",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			result, err := testCase.source.Password()
+
+			if (err == nil && len(testCase.wantErr) != 0) || (err != nil && err.Error() != testCase.wantErr) {
+				t.Errorf("Password() = %v, want %s", err, testCase.wantErr)
 			}
 
-			if failed {
-				t.Errorf("InPath(`%s`, `%s`) = (`%s`, %#v), want (`%s`, %#v)", testCase.path, testCase.key, result, err, testCase.want, testCase.wantErr)
+			if result != testCase.want {
+				t.Errorf("Password() = `%s`, want `%s`", result, testCase.want)
 			}
 		})
 	}
 }
 
-func TestInString(t *testing.T) {
-	vaultRaw := `$ANSIBLE_VAULT;1.1;AES256
-33623735333733316564643935636565663664376661326536303633366465343631626265303030
-3464346366613935623239353334383831323036363236660a366261643665316438623431376135
-32636366373330363438613439656261653932653033386132356265323937373733633834643432
-6238666665373737620a653565656635373165643936303337646234663133336438343236363662
-64646462623864306562623264316535653238656664383661353738623662393137`
+func TestAWSPasswordSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+
+		authorization := r.Header.Get("Authorization")
+
+		switch {
+		case r.Header.Get("X-Amz-Target") == "secretsmanager.GetSecretValue" && strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=ENV_KEY/") && strings.Contains(authorization, "/eu-west-1/secretsmanager/aws4_request"):
+			switch payload["SecretId"] {
+			case "ansible-vault":
+				_, _ = w.Write([]byte(`{"Name":"ansible-vault","SecretString":"sm_secret"}`))
+			case "ansible":
+				_, _ = w.Write([]byte(`{"Name":"ansible","SecretString":"{\"vault_pass\":\"sm_json_secret\"}"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","Message":"Secrets Manager can't find the specified secret."}`))
+			}
+		case r.Header.Get("X-Amz-Target") == "AmazonSSM.GetParameter" && strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=FILE_KEY/") && strings.Contains(authorization, "/us-east-1/ssm/aws4_request") && r.Header.Get("X-Amz-Security-Token") == "FILE_TOKEN":
+			if payload["Name"] == "/ansible/vault" && payload["WithDecryption"] == true {
+				_, _ = w.Write([]byte(`{"Parameter":{"Name":"/ansible/vault","Type":"SecureString","Value":"ssm_secret"}}`))
+				return
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.ssm#ParameterNotFound","message":""}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"__type":"UnrecognizedClientException","message":"The security token included in the request is invalid."}`))
+		}
+	}))
+	defer server.Close()
+
+	awsFolder := t.TempDir()
+
+	credentials := "[default]\naws_access_key_id = DEFAULT_KEY\naws_secret_access_key = DEFAULT_SECRET\n\n[ansible]\naws_access_key_id = FILE_KEY\naws_secret_access_key = FILE_SECRET\naws_session_token = FILE_TOKEN\n"
+	if err := os.WriteFile(path.Join(awsFolder, "credentials"), []byte(credentials), 0600); err != nil {
+		t.Fatalf("unable to write credentials: %s", err)
+	}
+
+	config := "[default]\nregion = eu-west-3\n\n[profile ansible]\nregion = us-east-1\n"
+	if err := os.WriteFile(path.Join(awsFolder, "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("unable to write config: %s", err)
+	}
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path.Join(awsFolder, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", path.Join(awsFolder, "config"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENV_KEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ENV_SECRET")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
 
 	var cases = []struct {
 		intention string
-		input     string
-		key       string
+		source    PasswordSource
 		want      string
-		wantErr   error
+		wantErr   string
 	}{
 		{
-			"simple",
-			vaultRaw,
-			"API_KEY",
-			"PROD_KEEP_IT_SECRET",
-			nil,
+			"secrets manager",
+			AWSSecretsManagerPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL}, SecretID: "ansible-vault"},
+			"sm_secret",
+			"",
 		},
 		{
-			"invalid format",
-			"novaultformat",
-			"API_KEY",
+			"secrets manager json key",
+			AWSSecretsManagerPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL}, SecretID: "ansible", JSONKey: "vault_pass"},
+			"sm_json_secret",
+			"",
+		},
+		{
+			"secrets manager unknown json key",
+			AWSSecretsManagerPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL}, SecretID: "ansible", JSONKey: "password"},
+			"",
+			"aws secretsmanager: no `password` string in secret ansible",
+		},
+		{
+			"secrets manager unknown secret",
+			AWSSecretsManagerPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL}, SecretID: "unknown"},
+			"",
+			"aws secretsmanager: ResourceNotFoundException: Secrets Manager can't find the specified secret.",
+		},
+		{
+			"secrets manager wrong region",
+			AWSSecretsManagerPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL, Region: "us-east-1"}, SecretID: "ansible-vault"},
+			"",
+			"aws secretsmanager: UnrecognizedClientException: The security token included in the request is invalid.",
+		},
+		{
+			"ssm with profile",
+			AWSSSMPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL, Profile: "ansible", Region: "us-east-1"}, Name: "/ansible/vault"},
+			"ssm_secret",
 			"",
-			errors.New("invalid secret format"),
+		},
+		{
+			"ssm unknown parameter",
+			AWSSSMPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL, Profile: "ansible", Region: "us-east-1"}, Name: "/ansible/unknown"},
+			"",
+			"aws ssm: ParameterNotFound",
+		},
+		{
+			"unknown profile",
+			AWSSSMPasswordSource{AWSConfig: AWSConfig{Endpoint: server.URL, Profile: "unknown"}, Name: "/ansible/vault"},
+			"",
+			"aws ssm: failed to get shared config profile, unknown",
 		},
 	}
 
-	var failed bool
-
 	for _, testCase := range cases {
 		t.Run(testCase.intention, func(t *testing.T) {
+			result, err := testCase.source.Password()
 
-			app, err := New("secret", path.Join(ansibleFolder, "group_vars"), "")
-			if err != nil {
-				t.Errorf("unable to create App: %#v", err)
-				return
+			if (err == nil && len(testCase.wantErr) != 0) || (err != nil && err.Error() != testCase.wantErr) {
+				t.Errorf("Password() = %v, want %s", err, testCase.wantErr)
 			}
 
-			result, err := app.InString(testCase.input, testCase.key)
+			if result != testCase.want {
+				t.Errorf("Password() = `%s`, want `%s`", result, testCase.want)
+			}
+		})
+	}
+}
+
+func TestAWSRegion(t *testing.T) {
+	awsFolder := t.TempDir()
+
+	config := "[default]\nregion = eu-west-3\n\n[profile ansible]\nregion = us-east-1\n"
+	if err := os.WriteFile(path.Join(awsFolder, "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("unable to write config: %s", err)
+	}
+
+	t.Setenv("AWS_CONFIG_FILE", path.Join(awsFolder, "config"))
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	var cases = []struct {
+		intention string
+		config    AWSConfig
+		want      string
+	}{
+		{
+			"explicit",
+			AWSConfig{Region: "ap-south-1", Profile: "ansible"},
+			"ap-south-1",
+		},
+		{
+			"default profile",
+			AWSConfig{},
+			"eu-west-3",
+		},
+		{
+			"named profile",
+			AWSConfig{Profile: "ansible"},
+			"us-east-1",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			cfg, err := testCase.config.load(context.Background())
+			if err != nil {
+				t.Fatalf("unable to load config: %s", err)
+			}
+
+			if cfg.Region != testCase.want {
+				t.Errorf("load() region = `%s`, want `%s`", cfg.Region, testCase.want)
+			}
+		})
+	}
+}
+
+func TestInEnv(t *testing.T) {
+	var cases = []struct {
+		intention  string
+		pattern    string
+		pathParams map[string]interface{}
+		key        string
+		want       string
+		wantErr    error
+	}{
+		{
+			"simple",
+			"group_vars/tag_{{.env}}/vault.yml",
+			map[string]interface{}{
+				"env": "prod",
+			},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"not existing env",
+			"group_vars/tag_{{.env}}/vault.yml",
+			map[string]interface{}{
+				"env": "dev",
+			},
+			"API_KEY",
+			"",
+			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "group_vars/tag_dev/vault.yml")),
+		},
+		{
+			"functions",
+			"{{ .folder | replace \"-\" \"_\" }}/tag_{{ .env | lower }}/{{ default \"vault\" .file }}.yml",
+			map[string]interface{}{
+				"folder": "group-vars",
+				"env":    "PROD",
+			},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"default with pipeline",
+			"group_vars/tag_{{ .env | default \"prod\" }}/vault.yml",
+			map[string]interface{}{},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"missing param",
+			"group_vars/tag_{{.env}}/vault.yml",
+			map[string]interface{}{
+				"environment": "prod",
+			},
+			"API_KEY",
+			"",
+			errors.New(`template: path_pattern:1:17: executing "path_pattern" at <.env>: map has no entry for key "env"`),
+		},
+		{
+			"path traversal in params",
+			"group_vars/tag_{{.env}}/vault.yml",
+			map[string]interface{}{
+				"env": "prod/../../../..",
+			},
+			"API_KEY",
+			"",
+			fmt.Errorf("%s is outside of root folder %s", path.Join(ansibleFolder, "../../vault.yml"), ansibleFolder),
+		},
+	}
+
+	var failed bool
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+
+			app, err := New("secret", ansibleFolder, map[string]string{DefaultPathPattern: testCase.pattern})
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InPathPattern("", testCase.pathParams, testCase.key)
 
 			failed = false
 
@@ -533,8 +1003,2588 @@ func TestInString(t *testing.T) {
 			}
 
 			if failed {
-				t.Errorf("InString() = (`%s`, %s), want (`%s`, %s)", result, err, testCase.want, testCase.wantErr)
+				t.Errorf("InEnv(`%s`, `%s`) = (`%s`, %#v), want (`%s`, %#v)", testCase.pathParams, testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInPathPatternSelection(t *testing.T) {
+	var cases = []struct {
+		intention   string
+		patternName string
+		pathParams  map[string]interface{}
+		key         string
+		want        string
+		wantErr     error
+	}{
+		{
+			"default pattern",
+			"",
+			map[string]interface{}{"env": "prod"},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"named pattern",
+			"root",
+			map[string]interface{}{"file": "simple_vault_test"},
+			"API_KEY",
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"unknown pattern",
+			"host_vars",
+			map[string]interface{}{"host": "localhost"},
+			"API_KEY",
+			"",
+			errors.New("unknown path pattern: host_vars"),
+		},
+	}
+
+	app, err := New("secret", ansibleFolder, map[string]string{
+		DefaultPathPattern: "group_vars/tag_{{.env}}/vault.yml",
+		"root":             "{{.file}}.yaml",
+	})
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			result, err := app.InPathPattern(testCase.patternName, testCase.pathParams, testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InPathPattern(`%s`, `%s`) = (`%s`, %v), want (`%s`, %v)", testCase.patternName, testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInPath(t *testing.T) {
+	var cases = []struct {
+		intention string
+		path      string
+		key       string
+		want      string
+		wantErr   error
+	}{
+		{
+			"simple",
+			"tag_prod/vault.yml",
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"not existing env",
+			"not_found.yml",
+			"API_KEY",
+			"",
+			fmt.Errorf("open %s: no such file or directory", path.Join(ansibleFolder, "group_vars", "not_found.yml")),
+		},
+		{
+			"path traversal",
+			"../simple_vault_test.yaml",
+			"API_KEY",
+			"",
+			fmt.Errorf("%s is outside of root folder %s", path.Join(ansibleFolder, "simple_vault_test.yaml"), path.Join(ansibleFolder, "group_vars")),
+		},
+	}
+
+	var failed bool
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+
+			app, err := New("secret", path.Join(ansibleFolder, "group_vars"), nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InPath(testCase.path, testCase.key)
+
+			failed = false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InPath(`%s`, `%s`) = (`%s`, %#v), want (`%s`, %#v)", testCase.path, testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInPaths(t *testing.T) {
+	var cases = []struct {
+		intention  string
+		paths      []string
+		key        string
+		want       string
+		wantSource string
+		wantErr    error
+	}{
+		{
+			"first hit",
+			[]string{"group_vars/tag_prod/vault.yml", "simple_vault_test.yaml"},
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			"group_vars/tag_prod/vault.yml",
+			nil,
+		},
+		{
+			"skip missing file",
+			[]string{"group_vars/tag_dev/vault.yml", "simple_vault_test.yaml"},
+			"API_KEY",
+			"NOT_IN_CLEAR_TEXT",
+			"simple_vault_test.yaml",
+			nil,
+		},
+		{
+			"skip missing key",
+			[]string{"group_vars/tag_multi/db.yml", "group_vars/tag_multi/app.yml"},
+			"API_KEY",
+			"MULTI_API_KEY",
+			"group_vars/tag_multi/app.yml",
+			nil,
+		},
+		{
+			"not found",
+			[]string{"group_vars/tag_dev/vault.yml", "group_vars/tag_multi/db.yml"},
+			"API_KEY",
+			"",
+			"",
+			errors.New("key `API_KEY` not found in group_vars/tag_dev/vault.yml, group_vars/tag_multi/db.yml"),
+		},
+		{
+			"invalid file",
+			[]string{"invalid_yaml_test.yaml", "simple_vault_test.yaml"},
+			"API_KEY",
+			"",
+			"",
+			fmt.Errorf("%s: invalid yaml: line 3, column 1: document is a !!str, not a mapping", path.Join(ansibleFolder, "invalid_yaml_test.yaml")),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, source, err := app.InPaths(testCase.paths, testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want || source != testCase.wantSource {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InPaths(%#v, `%s`) = (`%s`, `%s`, %v), want (`%s`, `%s`, %v)", testCase.paths, testCase.key, result, source, err, testCase.want, testCase.wantSource, testCase.wantErr)
 			}
 		})
 	}
 }
+
+func TestInString(t *testing.T) {
+	vaultRaw := `$ANSIBLE_VAULT;1.1;AES256
+33623735333733316564643935636565663664376661326536303633366465343631626265303030
+3464346366613935623239353334383831323036363236660a366261643665316438623431376135
+32636366373330363438613439656261653932653033386132356265323937373733633834643432
+6238666665373737620a653565656635373165643936303337646234663133336438343236363662
+64646462623864306562623264316535653238656664383661353738623662393137`
+
+	var cases = []struct {
+		intention string
+		input     string
+		key       string
+		want      string
+		wantErr   error
+	}{
+		{
+			"simple",
+			vaultRaw,
+			"API_KEY",
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"invalid format",
+			"novaultformat",
+			"API_KEY",
+			"",
+			errors.New("<string>: not an ansible vault"),
+		},
+	}
+
+	var failed bool
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+
+			app, err := New("secret", path.Join(ansibleFolder, "group_vars"), nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InString(testCase.input, testCase.key)
+
+			failed = false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InString() = (`%s`, %s), want (`%s`, %s)", result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInGlob(t *testing.T) {
+	var cases = []struct {
+		intention     string
+		pattern       string
+		key           string
+		mergeStrategy string
+		want          string
+		wantFile      string
+		wantErr       error
+	}{
+		{
+			"single file defining key",
+			"group_vars/tag_multi/*.yml",
+			"DB_USER",
+			"",
+			"admin",
+			"group_vars/tag_multi/db.yml",
+			nil,
+		},
+		{
+			"directory lookup",
+			"group_vars/tag_multi",
+			"API_KEY",
+			"",
+			"MULTI_API_KEY",
+			"group_vars/tag_multi/app.yml",
+			nil,
+		},
+		{
+			"ambiguous key",
+			"group_vars/tag_multi/*.yml",
+			"DB_PASSWORD",
+			"",
+			"",
+			"",
+			errors.New("key defined in several files: group_vars/tag_multi/app.yml and group_vars/tag_multi/db.yml"),
+		},
+		{
+			"first merge strategy",
+			"group_vars/tag_multi/*.yml",
+			"DB_PASSWORD",
+			MergeFirst,
+			"APP_DB_PASSWORD",
+			"group_vars/tag_multi/app.yml",
+			nil,
+		},
+		{
+			"last merge strategy",
+			"group_vars/tag_multi/*.yml",
+			"DB_PASSWORD",
+			MergeLast,
+			"DB_DB_PASSWORD",
+			"group_vars/tag_multi/db.yml",
+			nil,
+		},
+		{
+			"unknown merge strategy",
+			"group_vars/tag_multi/*.yml",
+			"DB_PASSWORD",
+			"random",
+			"",
+			"",
+			errors.New("unknown merge strategy: random"),
+		},
+		{
+			"not found key",
+			"group_vars/tag_multi/*.yml",
+			"SECRET_KEY",
+			"",
+			"",
+			"",
+			errors.New("key `SECRET_KEY` not found in group_vars/tag_multi/*.yml"),
+		},
+		{
+			"no matching file",
+			"group_vars/tag_dev/*.yml",
+			"API_KEY",
+			"",
+			"",
+			"",
+			errors.New("no file matched: group_vars/tag_dev/*.yml"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ansibleFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, file, err := app.InGlob(testCase.pattern, testCase.key, testCase.mergeStrategy)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want || file != testCase.wantFile {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InGlob(`%s`, `%s`) = (`%s`, `%s`, %v), want (`%s`, `%s`, %v)", testCase.pattern, testCase.key, result, file, err, testCase.want, testCase.wantFile, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestInRole(t *testing.T) {
+	rootFolder := t.TempDir()
+
+	encrypt := func(content string) string {
+		encrypted, err := ansible_vault.Encrypt(content, "secret")
+		if err != nil {
+			t.Fatalf("unable to encrypt fixture: %s", err)
+		}
+
+		return encrypted
+	}
+
+	inlineVault := "  " + strings.ReplaceAll(strings.TrimSpace(encrypt("INLINE_API_KEY")), "\n", "\n  ")
+
+	files := map[string]string{
+		"ansible.cfg":                                                  "[defaults]\nroles_path = shared_roles:/etc/ansible/roles\ncollections_path = galaxy\n",
+		"roles/app/vars/main.yml":                                      encrypt("DB_PASSWORD: VARS_DB_PASSWORD"),
+		"roles/app/defaults/main/10-base.yml":                          "DB_PASSWORD: DEFAULT_DB_PASSWORD\nDB_USER: base\nAPI_KEY: !vault |\n" + inlineVault + "\n",
+		"roles/app/defaults/main/20-override.yml":                      "DB_USER: override\n",
+		"shared_roles/web/defaults/main.yaml":                          "WEB_KEY: shared\n",
+		"galaxy/ansible_collections/acme/infra/roles/db/vars/main.yml": "DB_NAME: acme\n",
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(rootFolder, name)), 0700); err != nil {
+			t.Fatalf("unable to create fixture folder: %s", err)
+		}
+
+		if err := os.WriteFile(path.Join(rootFolder, name), []byte(content), 0600); err != nil {
+			t.Fatalf("unable to write fixture: %s", err)
+		}
+	}
+
+	var cases = []struct {
+		intention string
+		role      string
+		key       string
+		want      string
+		wantFile  string
+		wantErr   error
+	}{
+		{
+			"vars precedence over defaults",
+			"app",
+			"DB_PASSWORD",
+			"VARS_DB_PASSWORD",
+			"roles/app/vars/main.yml",
+			nil,
+		},
+		{
+			"last file of main directory",
+			"app",
+			"DB_USER",
+			"override",
+			"roles/app/defaults/main/20-override.yml",
+			nil,
+		},
+		{
+			"inline vault value",
+			"app",
+			"API_KEY",
+			"INLINE_API_KEY",
+			"roles/app/defaults/main/10-base.yml",
+			nil,
+		},
+		{
+			"roles path of ansible.cfg",
+			"web",
+			"WEB_KEY",
+			"shared",
+			"shared_roles/web/defaults/main.yaml",
+			nil,
+		},
+		{
+			"collection role",
+			"acme.infra.db",
+			"DB_NAME",
+			"acme",
+			"galaxy/ansible_collections/acme/infra/roles/db/vars/main.yml",
+			nil,
+		},
+		{
+			"unknown role",
+			"unknown",
+			"DB_NAME",
+			"",
+			"",
+			errors.New("role not found: unknown in roles, shared_roles, /etc/ansible/roles"),
+		},
+		{
+			"invalid role",
+			"../app",
+			"DB_NAME",
+			"",
+			"",
+			errors.New("role not found: invalid role name ../app"),
+		},
+		{
+			"not found key",
+			"app",
+			"SECRET_KEY",
+			"",
+			"",
+			errors.New("key `SECRET_KEY` not found in role app"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", rootFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, file, err := app.InRole(testCase.role, testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want || file != testCase.wantFile {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InRole(`%s`, `%s`) = (`%s`, `%s`, %v), want (`%s`, `%s`, %v)", testCase.role, testCase.key, result, file, err, testCase.want, testCase.wantFile, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	inlineVault, err := ansible_vault.Encrypt("inline_secret", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	encrypted, err := ansible_vault.Encrypt(`db_user: Admin
+db_password: secret
+db_url: "postgres://{{ db_user | lower }}:{{ db_password }}@db"
+empty: ""
+debug: true
+settings:
+  host: db
+  port: 5432
+  tags: [a, b]
+host: "{{ settings.host }}"
+nested: "{{ host }}:{{ settings['port'] }}"
+fallback: "{{ missing | default('none') }}"
+falsy: "{{ empty | default('none', true) }}"
+flag: "{{ debug }}"
+encoded: "{{ db_password | b64encode }}"
+json: "{{ settings | to_json }}"
+undefined: "{{ missing }}"
+filter: "{{ db_user | upper }}"
+block: "{% if debug %}yes{% endif %}"
+operator: "{{ db_user ~ db_password }}"
+loop: "{{ other_loop }}"
+other_loop: "{{ loop }}"
+credentials:
+  url: "{{ host }}/app"
+  password: |
+    `+strings.ReplaceAll(strings.TrimSpace(inlineVault), "\n", "\n    ")+`
+credentials_url: "{{ credentials.url }}"
+credentials_password: "{{ credentials['password'] }}"
+ratio: 1.0
+limits:
+  ratio: 1.0
+  host: "{{ host }}"
+version: "{{ ratio }}"
+limits_json: "{{ limits | to_json }}"
+link: "https://host/?q=a&name=<é>"
+link_json: "{{ link | to_json }}"
+`, "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	source := NewMapSource(map[string]string{
+		"vault.yml":                    encrypted,
+		"roles/app/defaults/main.yml":  "db_user: app\ndb_url: \"{{ db_user }}@default\"\n",
+		"roles/app/vars/main/url.yml":  "db_url: \"{{ db_user }}@{{ db_host }}\"\n",
+		"roles/app/vars/main/host.yml": "db_host: db\n",
+	})
+
+	var cases = []struct {
+		intention string
+		templates bool
+		key       string
+		want      string
+		wantErr   error
+	}{
+		{
+			"disabled",
+			false,
+			"db_url",
+			"postgres://{{ db_user | lower }}:{{ db_password }}@db",
+			nil,
+		},
+		{
+			"variables",
+			true,
+			"db_url",
+			"postgres://admin:secret@db",
+			nil,
+		},
+		{
+			"attributes of templated variable",
+			true,
+			"nested",
+			"db:5432",
+			nil,
+		},
+		{
+			"default of undefined variable",
+			true,
+			"fallback",
+			"none",
+			nil,
+		},
+		{
+			"default of falsy variable",
+			true,
+			"falsy",
+			"none",
+			nil,
+		},
+		{
+			"boolean",
+			true,
+			"flag",
+			"True",
+			nil,
+		},
+		{
+			"b64encode",
+			true,
+			"encoded",
+			"c2VjcmV0",
+			nil,
+		},
+		{
+			"to_json",
+			true,
+			"json",
+			`{"host": "db", "port": 5432, "tags": ["a", "b"]}`,
+			nil,
+		},
+		{
+			"templated attribute",
+			true,
+			"credentials_url",
+			"db/app",
+			nil,
+		},
+		{
+			"vault attribute",
+			true,
+			"credentials_password",
+			"inline_secret",
+			nil,
+		},
+		{
+			"float",
+			true,
+			"version",
+			"1.0",
+			nil,
+		},
+		{
+			"to_json float",
+			true,
+			"limits_json",
+			`{"host": "db", "ratio": 1.0}`,
+			nil,
+		},
+		{
+			"to_json escapes",
+			true,
+			"link_json",
+			`"https://host/?q=a&name=<\u00e9>"`,
+			nil,
+		},
+		{
+			"undefined variable",
+			true,
+			"undefined",
+			"",
+			errors.New("vault.yml: key `undefined`: undefined variable: `missing`"),
+		},
+		{
+			"unsupported filter",
+			true,
+			"filter",
+			"",
+			errors.New("vault.yml: key `filter`: unsupported template: `upper` filter, only default, lower, b64encode and to_json filters are supported"),
+		},
+		{
+			"unsupported block",
+			true,
+			"block",
+			"",
+			errors.New("vault.yml: key `block`: unsupported template: `{%` blocks are not supported"),
+		},
+		{
+			"unsupported operator",
+			true,
+			"operator",
+			"",
+			errors.New("vault.yml: key `operator`: unsupported template: `~` in `db_user ~ db_password`"),
+		},
+		{
+			"recursive loop",
+			true,
+			"loop",
+			"",
+			errors.New("vault.yml: key `loop`: unsupported template: recursive loop on `loop`"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ".", nil, WithSource(source), WithTemplates(testCase.templates))
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InPath("vault.yml", testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InPath(`%s`) = (`%s`, %v), want (`%s`, %v)", testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+
+	t.Run("role variables", func(t *testing.T) {
+		app, err := New("secret", ".", nil, WithSource(source), WithTemplates(true))
+		if err != nil {
+			t.Errorf("unable to create App: %#v", err)
+			return
+		}
+
+		if result, _, err := app.InRole("app", "db_url"); err != nil || result != "app@db" {
+			t.Errorf("InRole(`app`, `db_url`) = (`%s`, %v), want (`%s`, %v)", result, err, "app@db", nil)
+		}
+	})
+}
+
+func TestYAMLDocuments(t *testing.T) {
+	files := map[string]string{
+		"merge.yml": `defaults: &defaults
+  user: admin
+  port: 5432
+extra: &extra
+  user: extra
+  timeout: 30
+db:
+  <<: *defaults
+  port: 5433
+multi:
+  <<: [*extra, *defaults]
+alias: *defaults
+invalid:
+  <<: scalar
+`,
+		"multi.yml": `API_KEY: FIRST
+---
+API_KEY: SECOND
+nested:
+  value: true
+`,
+		"syntax.yml":    "API_KEY: [unclosed\nOTHER: value\n",
+		"settings.json": `{"API_KEY": "JSON"}`,
+		"scalars.yml": `enabled: yes
+disabled: Off
+upper: ON
+quoted: "yes"
+tagged: !!str no
+expiry: 2024-01-01
+ratio: 1.5
+big: 123456789012345678901234567890
+empty:
+`,
+	}
+
+	source := make(map[string]string, len(files))
+	for name, content := range files {
+		encrypted, err := ansible_vault.Encrypt(content, "secret")
+		if err != nil {
+			t.Fatalf("unable to encrypt fixture: %s", err)
+		}
+
+		source[name] = encrypted
+	}
+
+	var cases = []struct {
+		intention string
+		file      string
+		key       string
+		document  int
+		want      string
+		wantErr   error
+	}{
+		{
+			"merge key",
+			"merge.yml",
+			"db.user",
+			0,
+			"admin",
+			nil,
+		},
+		{
+			"explicit key over merge key",
+			"merge.yml",
+			"db.port",
+			0,
+			"5433",
+			nil,
+		},
+		{
+			"first mapping of merge sequence",
+			"merge.yml",
+			"multi.user",
+			0,
+			"extra",
+			nil,
+		},
+		{
+			"next mapping of merge sequence",
+			"merge.yml",
+			"multi.port",
+			0,
+			"5432",
+			nil,
+		},
+		{
+			"alias",
+			"merge.yml",
+			"alias.user",
+			0,
+			"admin",
+			nil,
+		},
+		{
+			"invalid merge value",
+			"merge.yml",
+			"invalid.user",
+			0,
+			"",
+			errors.New("merge.yml: invalid yaml: line 14, column 7: merge value must be a mapping or a sequence of mappings"),
+		},
+		{
+			"first document",
+			"multi.yml",
+			"API_KEY",
+			0,
+			"FIRST",
+			nil,
+		},
+		{
+			"second document",
+			"multi.yml",
+			"nested.value",
+			1,
+			"true",
+			nil,
+		},
+		{
+			"whole document",
+			"multi.yml",
+			"",
+			1,
+			"API_KEY: SECOND\nnested:\n    value: true",
+			nil,
+		},
+		{
+			"unknown document",
+			"multi.yml",
+			"API_KEY",
+			2,
+			"",
+			errors.New("multi.yml: document not found: document 2, only 2 in file"),
+		},
+		{
+			"document of json",
+			"settings.json",
+			"API_KEY",
+			1,
+			"",
+			errors.New("settings.json: document is only supported with yaml format, not json"),
+		},
+		{
+			"yaml 1.1 true",
+			"scalars.yml",
+			"enabled",
+			0,
+			"true",
+			nil,
+		},
+		{
+			"yaml 1.1 false",
+			"scalars.yml",
+			"disabled",
+			0,
+			"false",
+			nil,
+		},
+		{
+			"yaml 1.1 upper case",
+			"scalars.yml",
+			"upper",
+			0,
+			"true",
+			nil,
+		},
+		{
+			"quoted yaml 1.1 bool",
+			"scalars.yml",
+			"quoted",
+			0,
+			"yes",
+			nil,
+		},
+		{
+			"tagged yaml 1.1 bool",
+			"scalars.yml",
+			"tagged",
+			0,
+			"no",
+			nil,
+		},
+		{
+			"timestamp",
+			"scalars.yml",
+			"expiry",
+			0,
+			"2024-01-01",
+			nil,
+		},
+		{
+			"float",
+			"scalars.yml",
+			"ratio",
+			0,
+			"1.5",
+			nil,
+		},
+		{
+			"integer overflowing int",
+			"scalars.yml",
+			"big",
+			0,
+			"123456789012345678901234567890",
+			nil,
+		},
+		{
+			"null",
+			"scalars.yml",
+			"empty",
+			0,
+			"",
+			errors.New("key `empty` not found in scalars.yml"),
+		},
+		{
+			"syntax error",
+			"syntax.yml",
+			"API_KEY",
+			0,
+			"",
+			errors.New("syntax.yml: invalid yaml: line 1: did not find expected ',' or ']'"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ".", nil, WithSource(NewMapSource(source)))
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InDocument(testCase.document).InPath(testCase.file, testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InDocument(%d).InPath(`%s`, `%s`) = (`%s`, %v), want (`%s`, %v)", testCase.document, testCase.file, testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	files := map[string]string{
+		"service.json": `{"type": "service_account", "project_id": 42, "credentials": {"private_key": "KEY", "enabled": true}}`,
+		"list.json":    `["not", "an", "object"]`,
+		"app.env": `# database
+export DB_USER=admin
+DB_PASSWORD="p@ss \"word\"\nline"
+DB_NAME='db # name'
+DB_HOST=localhost # comment
+`,
+		".env.production": "API_KEY=PRODUCTION\n",
+		"invalid.env":     "API_KEY=VALUE\nINVALID\n",
+		"settings.ini": `global = value
+[database]
+password = secret
+[api.v1]
+key = API
+[colon]
+url: http://host:8080
+`,
+		".env.yml": "API_KEY: YAML\n",
+		"cert.pem": "-----BEGIN CERTIFICATE-----\nMII\n-----END CERTIFICATE-----\n",
+	}
+
+	source := make(map[string]string, len(files))
+	for name, content := range files {
+		encrypted, err := ansible_vault.Encrypt(content, "secret")
+		if err != nil {
+			t.Fatalf("unable to encrypt fixture: %s", err)
+		}
+
+		source[name] = encrypted
+	}
+
+	var cases = []struct {
+		intention string
+		file      string
+		key       string
+		format    string
+		want      string
+		wantErr   error
+	}{
+		{
+			"json",
+			"service.json",
+			"credentials.private_key",
+			"",
+			"KEY",
+			nil,
+		},
+		{
+			"json number",
+			"service.json",
+			"project_id",
+			"",
+			"42",
+			nil,
+		},
+		{
+			"json boolean",
+			"service.json",
+			"credentials.enabled",
+			"",
+			"true",
+			nil,
+		},
+		{
+			"json not found key",
+			"service.json",
+			"credentials.client_email",
+			"",
+			"",
+			errors.New("key `credentials.client_email` not found in service.json: no `client_email` in path"),
+		},
+		{
+			"json not an object",
+			"list.json",
+			"type",
+			"",
+			"",
+			errors.New("list.json: invalid json: payload is not an object"),
+		},
+		{
+			"json as yaml",
+			"service.json",
+			"type",
+			FormatYAML,
+			"service_account",
+			nil,
+		},
+		{
+			"dotenv export",
+			"app.env",
+			"DB_USER",
+			"",
+			"admin",
+			nil,
+		},
+		{
+			"dotenv double quotes",
+			"app.env",
+			"DB_PASSWORD",
+			"",
+			"p@ss \"word\"\nline",
+			nil,
+		},
+		{
+			"dotenv single quotes",
+			"app.env",
+			"DB_NAME",
+			"",
+			"db # name",
+			nil,
+		},
+		{
+			"dotenv comment",
+			"app.env",
+			"DB_HOST",
+			"",
+			"localhost",
+			nil,
+		},
+		{
+			"dotenv environment file",
+			".env.production",
+			"API_KEY",
+			"",
+			"PRODUCTION",
+			nil,
+		},
+		{
+			"invalid dotenv",
+			"invalid.env",
+			"API_KEY",
+			"",
+			"",
+			errors.New("invalid.env: invalid dotenv: line 2: expected `KEY=value`"),
+		},
+		{
+			"ini section",
+			"settings.ini",
+			"database.password",
+			"",
+			"secret",
+			nil,
+		},
+		{
+			"ini dotted section",
+			"settings.ini",
+			"api.v1.key",
+			"",
+			"API",
+			nil,
+		},
+		{
+			"ini colon delimiter",
+			"settings.ini",
+			"colon.url",
+			"",
+			"http://host:8080",
+			nil,
+		},
+		{
+			"yaml environment file",
+			".env.yml",
+			"API_KEY",
+			"",
+			"YAML",
+			nil,
+		},
+		{
+			"ini global",
+			"settings.ini",
+			"global",
+			"",
+			"value",
+			nil,
+		},
+		{
+			"raw",
+			"cert.pem",
+			"",
+			FormatRaw,
+			"-----BEGIN CERTIFICATE-----\nMII\n-----END CERTIFICATE-----",
+			nil,
+		},
+		{
+			"raw with key",
+			"cert.pem",
+			"certificate",
+			FormatRaw,
+			"",
+			errors.New("cert.pem: key `certificate` can't be read in raw format"),
+		},
+		{
+			"unknown format",
+			"cert.pem",
+			"",
+			"toml",
+			"",
+			errors.New("unknown format: toml"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ".", nil, WithSource(NewMapSource(source)))
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.InFormat(testCase.format).InPath(testCase.file, testCase.key)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("InFormat(`%s`).InPath(`%s`, `%s`) = (`%s`, %v), want (`%s`, %v)", testCase.format, testCase.file, testCase.key, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	repository := t.TempDir()
+
+	repo, err := git.PlainInit(repository, false)
+	if err != nil {
+		t.Fatalf("unable to init repository: %s", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unable to get worktree: %s", err)
+	}
+
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+
+	commitVault := func(content string, message string) string {
+		encrypted, err := ansible_vault.Encrypt(content, "secret")
+		if err != nil {
+			t.Fatalf("unable to encrypt fixture: %s", err)
+		}
+
+		if err := os.MkdirAll(path.Join(repository, "ansible/group_vars/tag_dev"), 0700); err != nil {
+			t.Fatalf("unable to create fixture folder: %s", err)
+		}
+
+		if err := os.WriteFile(path.Join(repository, "ansible/group_vars/tag_dev/vault.yml"), []byte(encrypted), 0600); err != nil {
+			t.Fatalf("unable to write fixture: %s", err)
+		}
+
+		if len(message) == 0 {
+			return ""
+		}
+
+		if _, err := worktree.Add("ansible/group_vars/tag_dev/vault.yml"); err != nil {
+			t.Fatalf("unable to add fixture: %s", err)
+		}
+
+		hash, err := worktree.Commit(message, &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatalf("unable to commit fixture: %s", err)
+		}
+
+		return hash.String()
+	}
+
+	released := commitVault("API_KEY: RELEASED", "release")
+
+	if _, err := repo.CreateTag("v1", plumbing.NewHash(released), nil); err != nil {
+		t.Fatalf("unable to create tag: %s", err)
+	}
+
+	if _, err := repo.CreateTag("v1-annotated", plumbing.NewHash(released), &git.CreateTagOptions{Tagger: signature, Message: "release"}); err != nil {
+		t.Fatalf("unable to create annotated tag: %s", err)
+	}
+
+	committed := commitVault("API_KEY: COMMITTED", "update")
+
+	commitVault("API_KEY: WORKING_TREE", "")
+
+	var cases = []struct {
+		intention  string
+		ref        string
+		path       string
+		want       string
+		wantCommit string
+		wantErr    error
+	}{
+		{
+			"head",
+			"HEAD",
+			"group_vars/tag_dev/vault.yml",
+			"COMMITTED",
+			committed,
+			nil,
+		},
+		{
+			"tag",
+			"v1",
+			"group_vars/tag_dev/vault.yml",
+			"RELEASED",
+			released,
+			nil,
+		},
+		{
+			"annotated tag",
+			"v1-annotated",
+			"group_vars/tag_dev/vault.yml",
+			"RELEASED",
+			released,
+			nil,
+		},
+		{
+			"unknown file",
+			"HEAD",
+			"group_vars/tag_prod/vault.yml",
+			"",
+			committed,
+			os.ErrNotExist,
+		},
+		{
+			"unknown ref",
+			"origin/unknown",
+			"group_vars/tag_dev/vault.yml",
+			"",
+			"",
+			ErrUnknownGitRef,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", path.Join(repository, "ansible"), nil, WithGit(repository, testCase.ref))
+
+			var result string
+			if err == nil {
+				result, err = app.InPath(testCase.path, "API_KEY")
+
+				if commit := app.Commit(); commit != testCase.wantCommit {
+					t.Errorf("Commit() = `%s`, want `%s`", commit, testCase.wantCommit)
+				}
+			}
+
+			if !errors.Is(err, testCase.wantErr) || (testCase.wantErr == nil && err != nil) {
+				t.Errorf("InPath() = %v, want %v", err, testCase.wantErr)
+			}
+
+			if result != testCase.want {
+				t.Errorf("InPath() = `%s`, want `%s`", result, testCase.want)
+			}
+		})
+	}
+
+	app, err := New("secret", path.Join(repository, "ansible"), nil, WithGit(repository, "HEAD"))
+	if err != nil {
+		t.Fatalf("unable to create App: %s", err)
+	}
+
+	if _, _, err := app.InGlob("group_vars/*/vault.yml", "API_KEY", MergeError); !errors.Is(err, ErrGitUnsupported) {
+		t.Errorf("InGlob() = %v, want %v", err, ErrGitUnsupported)
+	}
+
+	if _, err := app.Rekey("group_vars/tag_dev/vault.yml", Password{Value: "secret"}, Password{Value: "new_secret"}); !errors.Is(err, ErrReadOnlySource) {
+		t.Errorf("Rekey() = %v, want %v", err, ErrReadOnlySource)
+	}
+}
+
+func TestSource(t *testing.T) {
+	files := make(map[string]string)
+	for _, name := range []string{"simple_vault_test.yaml", "group_vars/tag_prod/vault.yml", "group_vars/tag_multi/app.yml", "group_vars/tag_multi/db.yml"} {
+		content, err := os.ReadFile(path.Join(ansibleFolder, name))
+		if err != nil {
+			t.Fatalf("unable to read fixture: %s", err)
+		}
+
+		files["bundle/ansible/"+name] = string(content)
+	}
+
+	archiveFolder := t.TempDir()
+
+	zipFile, err := os.Create(path.Join(archiveFolder, "bundle.zip"))
+	if err != nil {
+		t.Fatalf("unable to create zip: %s", err)
+	}
+
+	zipWriter := zip.NewWriter(zipFile)
+
+	tarFile, err := os.Create(path.Join(archiveFolder, "bundle.tar.gz"))
+	if err != nil {
+		t.Fatalf("unable to create tar: %s", err)
+	}
+
+	gzipWriter := gzip.NewWriter(tarFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for name, content := range files {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("unable to add zip entry: %s", err)
+		}
+
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatalf("unable to write zip entry: %s", err)
+		}
+
+		if err := tarWriter.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("unable to add tar entry: %s", err)
+		}
+
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatalf("unable to write tar entry: %s", err)
+		}
+	}
+
+	for _, closer := range []interface{ Close() error }{zipWriter, zipFile, tarWriter, gzipWriter, tarFile} {
+		if err := closer.Close(); err != nil {
+			t.Fatalf("unable to close archive: %s", err)
+		}
+	}
+
+	zipSource, err := NewArchiveSource(path.Join(archiveFolder, "bundle.zip"))
+	if err != nil {
+		t.Fatalf("unable to open zip: %s", err)
+	}
+
+	tarSource, err := NewArchiveSource(path.Join(archiveFolder, "bundle.tar.gz"))
+	if err != nil {
+		t.Fatalf("unable to open tar: %s", err)
+	}
+
+	treeFolder := t.TempDir()
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(treeFolder, name)), 0700); err != nil {
+			t.Fatalf("unable to create fixture folder: %s", err)
+		}
+
+		if err := os.WriteFile(path.Join(treeFolder, name), []byte(content), 0600); err != nil {
+			t.Fatalf("unable to write fixture: %s", err)
+		}
+	}
+
+	sources := map[string]Source{
+		"map": NewMapSource(files),
+		"fs":  FSSource{FS: os.DirFS(treeFolder)},
+		"zip": zipSource,
+		"tar": tarSource,
+	}
+
+	var cases = []struct {
+		intention string
+		path      string
+		key       string
+		glob      bool
+		want      string
+		wantErr   error
+	}{
+		{
+			"simple",
+			"simple_vault_test.yaml",
+			"API_KEY",
+			false,
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"nested",
+			"/group_vars/tag_prod/vault.yml",
+			"API_KEY",
+			false,
+			"PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"glob",
+			"group_vars/tag_multi",
+			"DB_USER",
+			true,
+			"admin",
+			nil,
+		},
+		{
+			"not found",
+			"group_vars/tag_dev/vault.yml",
+			"API_KEY",
+			false,
+			"",
+			os.ErrNotExist,
+		},
+		{
+			"outside root",
+			"../ansible.cfg",
+			"API_KEY",
+			false,
+			"",
+			&OutsideRootError{},
+		},
+		{
+			"outside source",
+			"../../../etc/passwd",
+			"API_KEY",
+			false,
+			"",
+			&OutsideRootError{},
+		},
+	}
+
+	for name, source := range sources {
+		for _, testCase := range cases {
+			t.Run(name+" "+testCase.intention, func(t *testing.T) {
+				app, err := New("secret", "bundle/ansible", nil, WithSource(source))
+				if err != nil {
+					t.Fatalf("unable to create App: %s", err)
+				}
+
+				var result string
+				if testCase.glob {
+					result, _, err = app.InGlob(testCase.path, testCase.key, MergeError)
+				} else {
+					result, err = app.InPath(testCase.path, testCase.key)
+				}
+
+				var outsideRoot *OutsideRootError
+				if _, ok := testCase.wantErr.(*OutsideRootError); ok {
+					if !errors.As(err, &outsideRoot) {
+						t.Errorf("InPath() = %v, want %T", err, testCase.wantErr)
+					}
+				} else if !errors.Is(err, testCase.wantErr) || (testCase.wantErr == nil && err != nil) {
+					t.Errorf("InPath() = %v, want %v", err, testCase.wantErr)
+				}
+
+				if result != testCase.want {
+					t.Errorf("InPath() = `%s`, want `%s`", result, testCase.want)
+				}
+			})
+		}
+	}
+}
+
+func TestS3Source(t *testing.T) {
+	objects := make(map[string]string)
+	for _, name := range []string{"simple_vault_test.yaml", "group_vars/tag_prod/vault.yml", "group_vars/tag_multi/app.yml", "group_vars/tag_multi/db.yml"} {
+		content, err := os.ReadFile(path.Join(ansibleFolder, name))
+		if err != nil {
+			t.Fatalf("unable to read fixture: %s", err)
+		}
+
+		objects["releases/v1/ansible/"+name] = string(content)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=MINIO_KEY/") || !strings.Contains(r.Header.Get("Authorization"), "/us-east-1/s3/aws4_request") || len(r.Header.Get("X-Amz-Content-Sha256")) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`))
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/ansible/") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`))
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/ansible/")
+
+		if len(key) != 0 {
+			content, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+				return
+			}
+
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(content))
+			}
+
+			return
+		}
+
+		query := r.URL.Query()
+		prefix := query.Get("prefix")
+		delimiter := query.Get("delimiter")
+
+		var keys []string
+		prefixes := make(map[string]bool)
+
+		for objectKey := range objects {
+			if !strings.HasPrefix(objectKey, prefix) {
+				continue
+			}
+
+			if index := strings.Index(strings.TrimPrefix(objectKey, prefix), delimiter); len(delimiter) != 0 && index != -1 {
+				prefixes[objectKey[:len(prefix)+index+1]] = true
+				continue
+			}
+
+			keys = append(keys, objectKey)
+		}
+
+		sort.Strings(keys)
+
+		// pages of 2 keys, continuation token being the index of next key
+		start := 0
+		if token := query.Get("continuation-token"); len(token) != 0 {
+			fmt.Sscan(token, &start)
+		}
+
+		end := start + 2
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var output strings.Builder
+		output.WriteString("<ListBucketResult>")
+		for _, objectKey := range keys[start:end] {
+			fmt.Fprintf(&output, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", objectKey, len(objects[objectKey]))
+		}
+		for commonPrefix := range prefixes {
+			fmt.Fprintf(&output, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", commonPrefix)
+		}
+		if end < len(keys) {
+			fmt.Fprintf(&output, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+		}
+		output.WriteString("</ListBucketResult>")
+
+		_, _ = w.Write([]byte(output.String()))
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "MINIO_KEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "MINIO_SECRET")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", path.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_ENDPOINT_URL", "")
+
+	var cases = []struct {
+		intention string
+		source    S3Source
+		path      string
+		key       string
+		glob      bool
+		want      string
+		wantErr   string
+	}{
+		{
+			"simple",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL}, Bucket: "ansible", Prefix: "releases/v1"},
+			"simple_vault_test.yaml",
+			"API_KEY",
+			false,
+			"NOT_IN_CLEAR_TEXT",
+			"",
+		},
+		{
+			"nested",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL + "/"}, Bucket: "ansible", Prefix: "releases/v1/"},
+			"group_vars/tag_prod/vault.yml",
+			"API_KEY",
+			false,
+			"PROD_KEEP_IT_SECRET",
+			"",
+		},
+		{
+			"glob directory",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL}, Bucket: "ansible", Prefix: "releases/v1"},
+			"group_vars/tag_multi",
+			"DB_USER",
+			true,
+			"admin",
+			"",
+		},
+		{
+			"glob pattern",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL}, Bucket: "ansible", Prefix: "releases/v1"},
+			"group_vars/*/vault.yml",
+			"API_KEY",
+			true,
+			"PROD_KEEP_IT_SECRET",
+			"",
+		},
+		{
+			"not found",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL}, Bucket: "ansible", Prefix: "releases/v1"},
+			"group_vars/tag_dev/vault.yml",
+			"API_KEY",
+			false,
+			"",
+			"open ansible/group_vars/tag_dev/vault.yml: file does not exist",
+		},
+		{
+			"no match",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL}, Bucket: "ansible", Prefix: "releases/v2"},
+			"group_vars/*/vault.yml",
+			"API_KEY",
+			true,
+			"",
+			"no file matched: group_vars/*/vault.yml",
+		},
+		{
+			"wrong region",
+			S3Source{AWSConfig: AWSConfig{Endpoint: server.URL, Region: "eu-west-1"}, Bucket: "ansible", Prefix: "releases/v1"},
+			"simple_vault_test.yaml",
+			"API_KEY",
+			false,
+			"",
+			"ansible/simple_vault_test.yaml: aws s3: open ansible/simple_vault_test.yaml: AccessDenied: Access Denied.",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", "ansible", nil, WithSource(testCase.source))
+			if err != nil {
+				t.Fatalf("unable to create App: %s", err)
+			}
+
+			var result string
+			if testCase.glob {
+				result, _, err = app.InGlob(testCase.path, testCase.key, MergeError)
+			} else {
+				result, err = app.InPath(testCase.path, testCase.key)
+			}
+
+			if (err == nil && len(testCase.wantErr) != 0) || (err != nil && err.Error() != testCase.wantErr) {
+				t.Errorf("InPath() = %v, want %s", err, testCase.wantErr)
+			}
+
+			if result != testCase.want {
+				t.Errorf("InPath() = `%s`, want `%s`", result, testCase.want)
+			}
+		})
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tempDir := t.TempDir()
+	rootFolder := path.Join(tempDir, "ansible")
+
+	if err := os.MkdirAll(path.Join(rootFolder, "group_vars"), 0700); err != nil {
+		t.Fatalf("unable to create root folder: %s", err)
+	}
+
+	if err := os.Symlink(tempDir, path.Join(rootFolder, "group_vars", "escape")); err != nil {
+		t.Fatalf("unable to create symlink: %s", err)
+	}
+
+	var cases = []struct {
+		intention        string
+		path             string
+		allowOutsideRoot bool
+		want             string
+		wantErr          error
+	}{
+		{
+			"simple",
+			"group_vars/vault.yml",
+			false,
+			path.Join(rootFolder, "group_vars/vault.yml"),
+			nil,
+		},
+		{
+			"dot dot inside root",
+			"group_vars/../vault.yml",
+			false,
+			path.Join(rootFolder, "vault.yml"),
+			nil,
+		},
+		{
+			"dot dot outside root",
+			"../../etc/shadow",
+			false,
+			"",
+			&OutsideRootError{Path: path.Join(tempDir, "../etc/shadow"), Root: rootFolder},
+		},
+		{
+			"symlink outside root",
+			"group_vars/escape/vault.yml",
+			false,
+			"",
+			&OutsideRootError{Path: path.Join(rootFolder, "group_vars/escape/vault.yml"), Root: rootFolder},
+		},
+		{
+			"allowed outside root",
+			"../vault.yml",
+			true,
+			path.Join(tempDir, "vault.yml"),
+			nil,
+		},
+		{
+			"leading tilde in file name",
+			"~vault.yml",
+			false,
+			path.Join(rootFolder, "~vault.yml"),
+			nil,
+		},
+		{
+			"environment variable not expanded",
+			"$HOME/vault.yml",
+			false,
+			path.Join(rootFolder, "$HOME/vault.yml"),
+			nil,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", rootFolder, nil, WithAllowOutsideRoot(testCase.allowOutsideRoot))
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.resolvePath(testCase.path)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && !reflect.DeepEqual(err, testCase.wantErr) {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("resolvePath(`%s`) = (`%s`, %v), want (`%s`, %v)", testCase.path, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("unable to get home directory: %s", err)
+	}
+
+	t.Setenv("ANSIBLE_TEST_FOLDER", "ansible")
+
+	var cases = []struct {
+		intention string
+		input     string
+		want      string
+	}{
+		{
+			"simple",
+			"group_vars/vault.yml",
+			"group_vars/vault.yml",
+		},
+		{
+			"home",
+			"~",
+			home,
+		},
+		{
+			"home relative",
+			"~/.vault_pass.txt",
+			path.Join(home, ".vault_pass.txt"),
+		},
+		{
+			"not leading tilde",
+			"group_vars/~/vault.yml",
+			"group_vars/~/vault.yml",
+		},
+		{
+			"environment variable",
+			"$HOME/${ANSIBLE_TEST_FOLDER}/vault.yml",
+			path.Join(os.Getenv("HOME"), "ansible/vault.yml"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			if result, err := ExpandPath(testCase.input); err != nil || result != testCase.want {
+				t.Errorf("ExpandPath(`%s`) = (`%s`, %v), want (`%s`, nil)", testCase.input, result, err, testCase.want)
+			}
+		})
+	}
+}
+
+func TestRenderPathPattern(t *testing.T) {
+	t.Setenv("ANSIBLE_TEST_ENV", "prod")
+
+	var cases = []struct {
+		intention  string
+		pattern    string
+		pathParams map[string]interface{}
+		want       string
+	}{
+		{
+			"no escaping",
+			"group_vars/{{ .env }}/vault.yml",
+			map[string]interface{}{"env": "a&b+c"},
+			"group_vars/a&b+c/vault.yml",
+		},
+		{
+			"upper",
+			"{{ upper .env }}",
+			map[string]interface{}{"env": "prod"},
+			"PROD",
+		},
+		{
+			"default with value",
+			"{{ default \"vault\" .file }}",
+			map[string]interface{}{"file": "secrets"},
+			"secrets",
+		},
+		{
+			"env",
+			"{{ env \"ANSIBLE_TEST_ENV\" }}",
+			nil,
+			"prod",
+		},
+		{
+			"join",
+			"{{ join \"_\" .env .region }}",
+			map[string]interface{}{"env": "prod", "region": "eu"},
+			"prod_eu",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			pattern, err := parsePathPattern(testCase.pattern)
+			if err != nil {
+				t.Errorf("unable to parse pattern: %s", err)
+				return
+			}
+
+			if result, err := pattern.render(testCase.pathParams); err != nil || result != testCase.want {
+				t.Errorf("render(%#v) = (`%s`, %v), want (`%s`, nil)", testCase.pathParams, result, err, testCase.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	app, err := New("secret", ansibleFolder, nil)
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	wrongApp, err := New("not_secret", ansibleFolder, nil)
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	_, err = app.InPath("sanitized_vault.yml", "nested.unknown")
+	var keyNotFound *KeyNotFoundError
+	if !errors.Is(err, ErrKeyNotFound) || !errors.As(err, &keyNotFound) || keyNotFound.Segment != "unknown" || keyNotFound.Key != "nested.unknown" {
+		t.Errorf("InPath() = %#v, want KeyNotFoundError", err)
+	}
+
+	_, err = app.InPath("not_found.yml", "API_KEY")
+	var fileNotFound *FileNotFoundError
+	if !errors.Is(err, os.ErrNotExist) || !errors.As(err, &fileNotFound) || fileNotFound.File != path.Join(ansibleFolder, "not_found.yml") {
+		t.Errorf("InPath() = %#v, want FileNotFoundError", err)
+	}
+
+	_, err = app.InPath("invalid_yaml_test.yaml", "API_KEY")
+	var fileErr *FileError
+	if !errors.Is(err, ErrInvalidYAML) || !errors.As(err, &fileErr) || fileErr.File != path.Join(ansibleFolder, "invalid_yaml_test.yaml") {
+		t.Errorf("InPath() = %#v, want ErrInvalidYAML", err)
+	}
+
+	if _, err = wrongApp.InPath("simple_vault_test.yaml", "API_KEY"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("InPath() = %#v, want ErrWrongPassword", err)
+	}
+
+	if _, err = app.InString("novaultformat", "API_KEY"); !errors.Is(err, ErrNotVault) {
+		t.Errorf("InString() = %#v, want ErrNotVault", err)
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	encrypted, err := ansible_vault.Encrypt("API_KEY: PROD_KEEP_IT_SECRET", "prod_secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt: %s", err)
+	}
+
+	withVaultID := strings.Replace(encrypted, "$ANSIBLE_VAULT;1.1;AES256", "$ANSIBLE_VAULT;1.2;AES256;prod", 1)
+	lines := strings.Split(encrypted, "\n")
+
+	var cases = []struct {
+		intention string
+		input     string
+		passwords []Password
+		want      string
+		wantErr   error
+	}{
+		{
+			"without vault id",
+			encrypted,
+			[]Password{{ID: "prod", Value: "prod_secret"}},
+			"API_KEY: PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"with vault id",
+			withVaultID,
+			[]Password{{ID: "dev", Value: "dev_secret"}, {ID: "prod", Value: "prod_secret"}},
+			"API_KEY: PROD_KEEP_IT_SECRET",
+			nil,
+		},
+		{
+			"not a vault",
+			"API_KEY: PROD_KEEP_IT_SECRET",
+			nil,
+			"",
+			ErrNotVault,
+		},
+		{
+			"bad header",
+			strings.Replace(encrypted, "1.1", "2.0", 1),
+			nil,
+			"",
+			errors.New("unsupported vault header: $ANSIBLE_VAULT;2.0;AES256"),
+		},
+		{
+			"bad hex envelope",
+			strings.Join(append(lines[:2], "<<<<<<< HEAD", strings.Join(lines[2:], "\n")), "\n"),
+			nil,
+			"",
+			errors.New("malformed vault content: encoding/hex: invalid byte: U+003C '<'"),
+		},
+		{
+			"wrong passwords",
+			encrypted,
+			[]Password{{ID: "dev", Value: "dev_secret"}},
+			"",
+			errors.New("wrong vault password, tried vault ids: default, dev"),
+		},
+		{
+			"wrong passwords with vault id",
+			withVaultID,
+			[]Password{{ID: "dev", Value: "dev_secret"}},
+			"",
+			errors.New("wrong vault password, encrypted with vault id `prod`, tried vault ids: default, dev"),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", ansibleFolder, nil, WithPasswords(testCase.passwords...))
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.decrypt(testCase.input)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if result != testCase.want {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("decrypt() = (`%s`, %v), want (`%s`, %v)", result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestRekey(t *testing.T) {
+	rootFolder := t.TempDir()
+
+	for _, file := range []string{"simple_vault_test.yaml", "complex_vault_test.yaml"} {
+		content, err := readFile(path.Join(ansibleFolder, file))
+		if err != nil {
+			t.Fatalf("unable to read fixture: %s", err)
+		}
+
+		if err := os.WriteFile(path.Join(rootFolder, file), []byte(content), 0600); err != nil {
+			t.Fatalf("unable to write fixture: %s", err)
+		}
+	}
+
+	var cases = []struct {
+		intention   string
+		pattern     string
+		oldPassword Password
+		newPassword Password
+		want        []string
+		wantErr     error
+	}{
+		{
+			"rekey",
+			"*.yaml",
+			Password{ID: DefaultVaultID, Value: "secret"},
+			Password{ID: "prod", Value: "new_secret"},
+			[]string{"complex_vault_test.yaml", "simple_vault_test.yaml"},
+			nil,
+		},
+		{
+			"already rekeyed",
+			"*.yaml",
+			Password{ID: DefaultVaultID, Value: "secret"},
+			Password{ID: "prod", Value: "new_secret"},
+			nil,
+			nil,
+		},
+		{
+			"wrong old password",
+			"simple_vault_test.yaml",
+			Password{ID: DefaultVaultID, Value: "not_secret"},
+			Password{ID: DefaultVaultID, Value: "other_secret"},
+			nil,
+			fmt.Errorf("%s: wrong vault password, encrypted with vault id `prod`, tried vault ids: default", path.Join(rootFolder, "simple_vault_test.yaml")),
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			app, err := New("secret", rootFolder, nil)
+			if err != nil {
+				t.Errorf("unable to create App: %#v", err)
+				return
+			}
+
+			result, err := app.Rekey(testCase.pattern, testCase.oldPassword, testCase.newPassword)
+
+			failed := false
+
+			if err == nil && testCase.wantErr != nil {
+				failed = true
+			} else if err != nil && testCase.wantErr == nil {
+				failed = true
+			} else if err != nil && err.Error() != testCase.wantErr.Error() {
+				failed = true
+			} else if !reflect.DeepEqual(result, testCase.want) {
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("Rekey(`%s`) = (%#v, %v), want (%#v, %v)", testCase.pattern, result, err, testCase.want, testCase.wantErr)
+			}
+		})
+	}
+
+	app, err := New("", rootFolder, nil, WithPasswords(Password{ID: "prod", Value: "new_secret"}))
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	if result, err := app.InPath("complex_vault_test.yaml", "API_secret"); err != nil || result != "password" {
+		t.Errorf("InPath() after Rekey() = (`%s`, %v), want (`password`, nil)", result, err)
+	}
+
+	if info, err := os.Stat(path.Join(rootFolder, "simple_vault_test.yaml")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Rekey() did not preserve file mode: %v", err)
+	}
+}
+
+func TestRekeyBackupGlob(t *testing.T) {
+	rootFolder := t.TempDir()
+	folder := path.Join(rootFolder, "group_vars", "prod")
+
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		t.Fatalf("unable to create fixture folder: %s", err)
+	}
+
+	encrypted, err := ansible_vault.Encrypt("API_KEY: PROD_KEY", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	if err := os.WriteFile(path.Join(folder, "vault.yml"), []byte(encrypted), 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	if err := os.WriteFile(path.Join(folder, ".hidden.yml"), []byte(encrypted), 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	app, err := New("secret", rootFolder, nil, WithBackup(true))
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	oldPassword := Password{ID: DefaultVaultID, Value: "secret"}
+	newPassword := Password{ID: DefaultVaultID, Value: "new_secret"}
+
+	if _, err := app.Rekey("group_vars/prod", oldPassword, newPassword); err != nil {
+		t.Fatalf("Rekey() = %v, want nil", err)
+	}
+
+	if _, err := os.Stat(path.Join(folder, "vault.yml.bak")); err != nil {
+		t.Fatalf("Rekey() did not keep a backup: %v", err)
+	}
+
+	for _, passwords := range [][]Password{{newPassword}, {newPassword, oldPassword}} {
+		app, err := New("", rootFolder, nil, WithPasswords(passwords...))
+		if err != nil {
+			t.Fatalf("unable to create App: %#v", err)
+		}
+
+		if result, file, err := app.InGlob("group_vars/prod", "API_KEY", ""); err != nil || result != "PROD_KEY" || file != "group_vars/prod/vault.yml" {
+			t.Errorf("InGlob() with %d passwords = (`%s`, `%s`, %v), want (`PROD_KEY`, `group_vars/prod/vault.yml`, nil)", len(passwords), result, file, err)
+		}
+	}
+
+	result, err := app.Rekey("group_vars/prod", newPassword, oldPassword)
+	if err != nil || len(result) != 1 {
+		t.Errorf("Rekey() of backups = (%#v, %v), want only vault.yml", result, err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	errInterrupted := errors.New("interrupted")
+
+	var cases = []struct {
+		intention  string
+		backup     bool
+		writeData  func(*os.File, []byte) error
+		renameFile func(string, string) error
+		want       string
+		wantBackup bool
+		wantErr    error
+	}{
+		{
+			"simple",
+			false,
+			writeAndSync,
+			os.Rename,
+			"new content",
+			false,
+			nil,
+		},
+		{
+			"with backup",
+			true,
+			writeAndSync,
+			os.Rename,
+			"new content",
+			true,
+			nil,
+		},
+		{
+			"interrupted write",
+			true,
+			func(file *os.File, data []byte) error {
+				if _, err := file.Write(data[:3]); err != nil {
+					return err
+				}
+
+				return errInterrupted
+			},
+			os.Rename,
+			"old content",
+			false,
+			errInterrupted,
+		},
+		{
+			"interrupted rename",
+			false,
+			writeAndSync,
+			func(string, string) error {
+				return errInterrupted
+			},
+			"old content",
+			false,
+			errInterrupted,
+		},
+	}
+
+	defer func() {
+		writeData = writeAndSync
+		renameFile = os.Rename
+	}()
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			rootFolder := t.TempDir()
+			filename := path.Join(rootFolder, "vault.yml")
+
+			if err := os.WriteFile(filename, []byte("old content"), 0640); err != nil {
+				t.Fatalf("unable to write fixture: %s", err)
+			}
+
+			writeData = testCase.writeData
+			renameFile = testCase.renameFile
+
+			app, err := New("secret", rootFolder, nil, WithBackup(testCase.backup))
+			if err != nil {
+				t.Fatalf("unable to create App: %#v", err)
+			}
+
+			err = app.writeFile(filename, []byte("new content"))
+
+			content, _ := os.ReadFile(filename)
+			info, _ := os.Stat(filename)
+			_, backupErr := os.Stat(filename + backupSuffix)
+			entries, _ := os.ReadDir(rootFolder)
+
+			wantEntries := 1
+			if testCase.wantBackup {
+				wantEntries = 2
+			}
+
+			if err != testCase.wantErr {
+				t.Errorf("writeFile() = %v, want %v", err, testCase.wantErr)
+			}
+
+			if string(content) != testCase.want || info.Mode().Perm() != 0640 {
+				t.Errorf("writeFile() content = (`%s`, %s), want (`%s`, %s)", content, info.Mode().Perm(), testCase.want, os.FileMode(0640))
+			}
+
+			if (backupErr == nil) != testCase.wantBackup || len(entries) != wantEntries {
+				t.Errorf("writeFile() left %d files with backup %v, want %d with backup %t", len(entries), backupErr == nil, wantEntries, testCase.wantBackup)
+			}
+		})
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	var cases = []struct {
+		intention string
+		held      bool
+		exclusive bool
+		want      string
+		wantErr   error
+	}{
+		{
+			"unlocked",
+			false,
+			false,
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"shared lock held",
+			true,
+			false,
+			"NOT_IN_CLEAR_TEXT",
+			nil,
+		},
+		{
+			"exclusive lock held",
+			true,
+			true,
+			"",
+			ErrLocked,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.intention, func(t *testing.T) {
+			rootFolder := t.TempDir()
+			filename := path.Join(rootFolder, "vault.yml")
+
+			encrypted, err := ansible_vault.Encrypt("API_KEY: NOT_IN_CLEAR_TEXT", "secret")
+			if err != nil {
+				t.Fatalf("unable to encrypt fixture: %s", err)
+			}
+
+			if err := os.WriteFile(filename, []byte(encrypted), 0600); err != nil {
+				t.Fatalf("unable to write fixture: %s", err)
+			}
+
+			app, err := New("secret", rootFolder, nil, WithLockTimeout(100*time.Millisecond))
+			if err != nil {
+				t.Fatalf("unable to create App: %#v", err)
+			}
+
+			if testCase.held {
+				// lock file is created by a write
+				unlockFile, err := app.lockFile(filename, true)
+				if err != nil {
+					t.Fatalf("unable to create lock file: %s", err)
+				}
+
+				unlockFile()
+
+				unlockFile, err = app.lockFile(filename, testCase.exclusive)
+				if err != nil {
+					t.Fatalf("unable to lock fixture: %s", err)
+				}
+
+				defer unlockFile()
+			}
+
+			result, err := app.InPath("vault.yml", "API_KEY")
+
+			if !errors.Is(err, testCase.wantErr) || (testCase.wantErr == nil && err != nil) {
+				t.Errorf("InPath() = %v, want %v", err, testCase.wantErr)
+			}
+
+			if result != testCase.want {
+				t.Errorf("InPath() = `%s`, want `%s`", result, testCase.want)
+			}
+
+			if _, err := app.Rekey("vault.yml", Password{ID: DefaultVaultID, Value: "secret"}, Password{ID: DefaultVaultID, Value: "new_secret"}); testCase.held != errors.Is(err, ErrLocked) {
+				t.Errorf("Rekey() = %v, want locked %t", err, testCase.held)
+			}
+		})
+	}
+}
+
+func TestLockReplacedFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("locking is not available on windows")
+	}
+
+	rootFolder := t.TempDir()
+	filename := path.Join(rootFolder, "vault.yml")
+
+	if err := os.WriteFile(filename, []byte("API_KEY: NOT_IN_CLEAR_TEXT\n"), 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	app, err := New("secret", rootFolder, nil, WithLockTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	unlockFile, err := app.lockFile(filename, true)
+	if err != nil {
+		t.Fatalf("unable to lock fixture: %s", err)
+	}
+
+	defer unlockFile()
+
+	if err := app.writeFile(filename, []byte("API_KEY: CHANGED\n")); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	// lock is still held once file is replaced by a new one
+	if _, err := app.lockFile(filename, true); !errors.Is(err, ErrLocked) {
+		t.Errorf("lockFile() = %v, want %v", err, ErrLocked)
+	}
+}
+
+func TestConcurrentRekey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("locking is not available on windows")
+	}
+
+	rootFolder := t.TempDir()
+	names := []string{"app.yml", "db.yml", "web.yml"}
+
+	for _, name := range names {
+		encrypted, err := ansible_vault.Encrypt("API_KEY: NOT_IN_CLEAR_TEXT", "secret")
+		if err != nil {
+			t.Fatalf("unable to encrypt fixture: %s", err)
+		}
+
+		if err := os.WriteFile(path.Join(rootFolder, name), []byte(encrypted), 0600); err != nil {
+			t.Fatalf("unable to write fixture: %s", err)
+		}
+	}
+
+	app, err := New("secret", rootFolder, nil)
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	oldPassword := Password{ID: DefaultVaultID, Value: "secret"}
+	newPassword := Password{ID: DefaultVaultID, Value: "new_secret"}
+
+	var wg sync.WaitGroup
+	results := make([][]string, 2)
+	errs := make([]error, 2)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = app.Rekey("*.yml", oldPassword, newPassword)
+		}(i)
+	}
+
+	wg.Wait()
+
+	var changed []string
+	for i := range results {
+		if errs[i] != nil {
+			t.Errorf("Rekey() = %v, want nil", errs[i])
+		}
+
+		changed = append(changed, results[i]...)
+	}
+
+	// each file is rekeyed once, the other rekey finds it already encrypted with new password
+	sort.Strings(changed)
+	if want := []string{"app.yml", "db.yml", "web.yml"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Rekey() changed %v, want %v", changed, want)
+	}
+
+	newApp, err := New("new_secret", rootFolder, nil)
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	for _, name := range names {
+		if result, err := newApp.InPath(name, "API_KEY"); err != nil || result != "NOT_IN_CLEAR_TEXT" {
+			t.Errorf("InPath(`%s`) = (`%s`, %v), want (`NOT_IN_CLEAR_TEXT`, nil)", name, result, err)
+		}
+
+		lockName, err := lockFilename(path.Join(rootFolder, name))
+		if err != nil {
+			t.Fatalf("unable to get lock file: %s", err)
+		}
+
+		if _, err := os.Stat(lockName); err != nil {
+			t.Errorf("lock file of `%s` = %v, want nil", name, err)
+		}
+	}
+
+	if entries, err := os.ReadDir(rootFolder); err != nil || len(entries) != len(names) {
+		t.Errorf("files of root folder = (%d, %v), want only vault files", len(entries), err)
+	}
+}
+
+func TestReadWithoutLockFile(t *testing.T) {
+	rootFolder := t.TempDir()
+	filename := path.Join(rootFolder, "vault.yml")
+
+	encrypted, err := ansible_vault.Encrypt("API_KEY: NOT_IN_CLEAR_TEXT", "secret")
+	if err != nil {
+		t.Fatalf("unable to encrypt fixture: %s", err)
+	}
+
+	if err := os.WriteFile(filename, []byte(encrypted), 0600); err != nil {
+		t.Fatalf("unable to write fixture: %s", err)
+	}
+
+	app, err := New("secret", rootFolder, nil)
+	if err != nil {
+		t.Fatalf("unable to create App: %#v", err)
+	}
+
+	if result, err := app.InPath("vault.yml", "API_KEY"); err != nil || result != "NOT_IN_CLEAR_TEXT" {
+		t.Errorf("InPath() = (`%s`, %v), want (`NOT_IN_CLEAR_TEXT`, nil)", result, err)
+	}
+
+	lockName, err := lockFilename(filename)
+	if err != nil {
+		t.Fatalf("unable to get lock file: %s", err)
+	}
+
+	if _, err := os.Stat(lockName); !os.IsNotExist(err) {
+		t.Errorf("lock file after read = %v, want not exist", err)
+	}
+
+	if entries, err := os.ReadDir(rootFolder); err != nil || len(entries) != 1 {
+		t.Errorf("files of root folder = (%d, %v), want only vault file", len(entries), err)
+	}
+}
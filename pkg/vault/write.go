@@ -0,0 +1,119 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix is appended to file name of the backup copy
+const backupSuffix = ".bak"
+
+// overridable for simulating interrupted writes in tests
+var (
+	writeData  = writeAndSync
+	renameFile = os.Rename
+)
+
+// writeFile atomically replaces file content: data is written and synced to a temporary file
+// in the same directory, with mode and ownership of the original file, then renamed over it.
+// A `.bak` copy of the original file is kept if backup is enabled.
+// Caller must hold an exclusive lock on file.
+func (a App) writeFile(filename string, data []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filename)
+
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmpFile.Name()
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if err := writeData(tmpFile, data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Chmod(info.Mode()); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	if err := chown(tmpFile, info); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if a.backup {
+		if err := backupFile(filename, info); err != nil {
+			return err
+		}
+	}
+
+	if err := renameFile(tmpName, filename); err != nil {
+		return err
+	}
+
+	renamed = true
+
+	return syncDir(dir)
+}
+
+func writeAndSync(file *os.File, data []byte) error {
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// backupFile copies file to its `.bak` sibling, with the same guarantees as writeFile
+func backupFile(filename string, info os.FileInfo) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	backupName := filename + backupSuffix
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(backupName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	if err := writeAndSync(tmpFile, content); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Chmod(info.Mode()); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), backupName)
+}
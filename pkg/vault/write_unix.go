@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package vault
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// chown gives file the ownership of info, it's a best effort when not permitted
+func chown(file *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if err := file.Chown(int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	return nil
+}
+
+// syncDir persists rename of a file in dir
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := dirFile.Sync(); err != nil {
+		_ = dirFile.Close()
+		return err
+	}
+
+	return dirFile.Close()
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package vault
+
+import (
+	"os"
+)
+
+// chown is not supported on windows, ownership is inherited from directory
+func chown(_ *os.File, _ os.FileInfo) error {
+	return nil
+}
+
+// syncDir is not supported on windows, rename is persisted by the filesystem
+func syncDir(_ string) error {
+	return nil
+}
@@ -0,0 +1,174 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	yamlMergeTag = "!!merge"
+	yamlNullTag  = "!!null"
+	yamlIntTag   = "!!int"
+	yamlBoolTag  = "!!bool"
+)
+
+// ErrDocumentNotFound occurs when document index is greater than documents of a multi-document file
+var ErrDocumentNotFound = errors.New("document not found")
+
+// yaml11Bools are plain scalars resolved as booleans by YAML 1.1, as ansible does, whereas YAML 1.2 keeps them as strings
+var yaml11Bools = map[string]bool{
+	"yes": true, "Yes": true, "YES": true,
+	"on": true, "On": true, "ON": true,
+	"no": false, "No": false, "NO": false,
+	"off": false, "Off": false, "OFF": false,
+}
+
+// yamlErrorLine extracts line of a yaml parser error, e.g. `yaml: line 3: mapping values are not allowed in this context`
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// InDocument returns a copy of App reading keys in document at given index, from zero, of multi-document files
+func (a App) InDocument(document int) App {
+	a.document = document
+
+	return a
+}
+
+// parseYAMLDocument returns root node of document at given index, nil if document is empty
+func parseYAMLDocument(content string, document int) (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+
+	for index := 0; ; index++ {
+		var node yaml.Node
+
+		if err := decoder.Decode(&node); err == io.EOF {
+			if index == 0 && document == 0 {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("%w: document %d, only %d in file", ErrDocumentNotFound, document, index)
+		} else if err != nil {
+			return nil, newYAMLError(err)
+		}
+
+		if index != document {
+			continue
+		}
+
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+
+		return resolveYAMLAlias(node.Content[0]), nil
+	}
+}
+
+// resolveYAMLAlias returns node referenced by an alias, node itself otherwise
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// yamlMappingValue returns value of key in a mapping node, explicit keys taking precedence over merged ones.
+// Merged mappings are searched in order, the first one defining key is used.
+func yamlMappingValue(node *yaml.Node, key string) (*yaml.Node, error) {
+	var value *yaml.Node
+	var merges []*yaml.Node
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := resolveYAMLAlias(node.Content[i])
+		valueNode := resolveYAMLAlias(node.Content[i+1])
+
+		if keyNode.Kind == yaml.ScalarNode && keyNode.ShortTag() == yamlMergeTag {
+			merges = append(merges, valueNode)
+			continue
+		}
+
+		// last definition of a duplicated key is used, as ansible does
+		if keyNode.Kind == yaml.ScalarNode && keyNode.Value == key {
+			value = valueNode
+		}
+	}
+
+	if value != nil {
+		return value, nil
+	}
+
+	for _, merge := range merges {
+		mappings := []*yaml.Node{merge}
+
+		if merge.Kind == yaml.SequenceNode {
+			mappings = mappings[:0]
+			for _, item := range merge.Content {
+				mappings = append(mappings, resolveYAMLAlias(item))
+			}
+		}
+
+		for _, mapping := range mappings {
+			if mapping.Kind != yaml.MappingNode {
+				return nil, &YAMLError{Line: mapping.Line, Column: mapping.Column, Message: "merge value must be a mapping or a sequence of mappings"}
+			}
+
+			value, err := yamlMappingValue(mapping, key)
+			if err != nil || value != nil {
+				return value, err
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// yamlScalar returns value of a scalar node, false if it is null
+func yamlScalar(node *yaml.Node) (string, bool) {
+	if node.Kind != yaml.ScalarNode {
+		return "", false
+	}
+
+	switch tag := node.ShortTag(); tag {
+	case yamlNullTag:
+		return "", false
+	case yamlIntTag:
+		// integers overflowing int are kept as written
+		var value int
+		if err := node.Decode(&value); err != nil {
+			return node.Value, true
+		}
+
+		return strconv.Itoa(value), true
+	case yamlBoolTag:
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return "", false
+		}
+
+		return strconv.FormatBool(value), true
+	default:
+		// YAML 1.1 booleans of untagged plain scalars only, `"yes"` or `!!str yes` are strings
+		if value, ok := yaml11Bools[node.Value]; ok && node.Style == 0 {
+			return strconv.FormatBool(value), true
+		}
+
+		// floats, timestamps and custom tags, e.g. `!vault`, are kept as written
+		return node.Value, true
+	}
+}
+
+// newYAMLError converts a yaml parser error to a YAMLError. Parser only reports a line, Column is left to zero.
+func newYAMLError(err error) *YAMLError {
+	if matches := yamlErrorLine.FindStringSubmatch(err.Error()); matches != nil {
+		line, _ := strconv.Atoi(matches[1])
+
+		return &YAMLError{Line: line, Message: matches[2]}
+	}
+
+	return &YAMLError{Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}